@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"gfsloader/internal/catalog"
+	"gfsloader/internal/grid"
+	"gfsloader/utils/indexfile"
+	"gfsloader/utils/noaa"
+)
+
+// maxWindowSteps limit of messages combined for one interval
+const maxWindowSteps = 8
+
+// accumulator de-accumulate messages of forecast hours of run. GFS accumulates
+// and averages some fields over windows that reset every few hours ("0-3 hour acc",
+// "0-6 hour acc"), so value over an interval is combined from messages of several
+// forecast hours
+type accumulator struct {
+	l   *loader
+	run noaa.Run
+	// integrals computed integrals by param:level:start-end
+	integrals map[string]*grid.Field
+	bytes     int64
+}
+
+func (l *loader) newAccumulator(run noaa.Run) *accumulator {
+	return &accumulator{
+		l:         l,
+		run:       run,
+		integrals: make(map[string]*grid.Field),
+	}
+}
+
+// interval return forecast hours the accumulated values of forecastTime are computed over
+func (l *loader) interval(forecastTime int) (from, to int) {
+	return max(forecastTime-l.cfg.ForecastStep, 0), forecastTime
+}
+
+// value return accumulated variable over interval [from, to] on grid of land in
+// GRIB units, as stored. Values are NaN when interval is empty (analysis hour)
+func (a *accumulator) value(ctx context.Context, v catalog.Variable, from, to int, land *grid.Field) (*grid.Field, error) {
+	if from >= to {
+		return land.Map(func(float32) float32 { return float32(math.NaN()) }), nil
+	}
+
+	integral, err := a.integral(ctx, v.Param, v.Level, from, to, maxWindowSteps)
+	if err != nil {
+		return nil, errors.Join(ErrProcess, fmt.Errorf("\"%s-%s\" %d-%d hour: %w", v.Param, v.Level, from, to, err))
+	}
+
+	hours := float32(to - from)
+	res := integral.Resample(land)
+	if v.Accumulation == catalog.AccumulationRate {
+		res = res.Map(func(x float32) float32 { return x / hours })
+	}
+	return res, nil
+}
+
+// integral return param:level accumulated over hours [from, to], averaged
+// values are multiplied by window hours. Messages ending at to are combined
+// with integrals over the rest of the interval
+func (a *accumulator) integral(ctx context.Context, param, level string, from, to, steps int) (*grid.Field, error) {
+	key := fmt.Sprintf("%s:%s:%d-%d", param, level, from, to)
+	if f, ok := a.integrals[key]; ok {
+		return f, nil
+	}
+	if steps == 0 {
+		return nil, errors.New("too many windows")
+	}
+
+	idx, err := loadIndex(ctx, a.l.source, a.run, to, a.baseFileName(to)+".idx")
+	if err != nil {
+		return nil, err
+	}
+
+	// exact window, else the nearest window starting before from, else the
+	// longest window starting after from
+	var exact, before, after *indexfile.Window
+	for _, w := range idx.Windows(param, level) {
+		switch {
+		case w.End != to:
+		case w.Start == from:
+			exact = &w
+		case w.Start < from:
+			if before == nil || w.Start > before.Start {
+				before = &w
+			}
+		default:
+			if after == nil || w.Start < after.Start {
+				after = &w
+			}
+		}
+	}
+
+	var res *grid.Field
+	switch {
+	case exact != nil:
+		res, err = a.window(ctx, idx, param, level, *exact)
+	case before != nil:
+		res, err = a.combine(ctx, idx, param, level, *before, before.Start, from, steps,
+			func(x, y float32) float32 { return x - y })
+	case after != nil:
+		res, err = a.combine(ctx, idx, param, level, *after, from, after.Start, steps,
+			func(x, y float32) float32 { return x + y })
+	default:
+		err = fmt.Errorf("no accumulated message ending at hour %d: %w", to, indexfile.ErrOffsetNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	a.integrals[key] = res
+	return res, nil
+}
+
+// combine apply op to integral of window w and integral over [from, to]
+func (a *accumulator) combine(ctx context.Context, idx *indexfile.IndexFile, param, level string, w indexfile.Window, from, to, steps int, op func(x, y float32) float32) (*grid.Field, error) {
+	field, err := a.window(ctx, idx, param, level, w)
+	if err != nil {
+		return nil, err
+	}
+
+	rest, err := a.integral(ctx, param, level, from, to, steps-1)
+	if err != nil {
+		return nil, err
+	}
+
+	return field.Combine(rest, op)
+}
+
+// window download message of param:level over window w and return its integral
+func (a *accumulator) window(ctx context.Context, idx *indexfile.IndexFile, param, level string, w indexfile.Window) (*grid.Field, error) {
+	gribFile := fmt.Sprintf("%s_%s_%s_%d-%d_%s", a.baseFileName(w.End), param, level, w.Start, w.End, w.Stat)
+	defer cacheFiles.lock(gribFile)()
+
+	if _, err := os.Stat(gribFile); errors.Is(err, os.ErrNotExist) {
+		from, to, err := idx.GetWindowOffset(param, level, w)
+		if err != nil {
+			return nil, err
+		}
+
+		err = a.l.source.FetchRange(ctx, fmt.Sprintf("Get %s:%s:%d-%d", param, level, w.Start, w.End), a.run, w.End, from, to, gribFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	st, err := os.Stat(gribFile)
+	if err != nil {
+		return nil, err
+	}
+	a.bytes += st.Size()
+
+	fields, err := getGribFields(gribFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("\"%s-%s\" has wrong message count", param, level)
+	}
+
+	field := fields[0]
+
+	if w.Stat == indexfile.StatAverage {
+		hours := float32(w.Hours())
+		field = field.Map(func(x float32) float32 { return x * hours })
+	}
+	return field, nil
+}
+
+func (a *accumulator) baseFileName(forecastTime int) string {
+	return filepath.Join(a.l.cfg.CacheDir, fmt.Sprintf("%s_%d", runCacheName(a.l.cfg, a.run), forecastTime))
+}
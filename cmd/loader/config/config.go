@@ -0,0 +1,531 @@
+// Package config load loader settings.
+//
+// Values are applied in order: defaults, config file (YAML or TOML),
+// environment variables (GFSLOADER_*), command-line flags. Later sources
+// override earlier ones.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gfsloader/internal/source"
+	"gfsloader/utils/download"
+	"gfsloader/utils/noaa"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	envPrefix  = "GFSLOADER_"
+	dateFormat = "2006-01-02"
+
+	// maxForecastHour last forecast hour published by GFS
+	maxForecastHour = 384
+	// maxLevel highest isobaric level (hPa) published by GFS
+	maxLevel = 1000
+)
+
+// Download modes
+const (
+	// ModeIdx download layers by .idx byte ranges
+	ModeIdx = "idx"
+	// ModeFilter download one subset file per forecast hour from NOMADS grib-filter
+	ModeFilter = "filter"
+)
+
+// GRIB sources
+const (
+	SourceNOMADS = "nomads"
+	SourceS3     = "s3"
+	SourceLocal  = "local"
+)
+
+var (
+	ErrConfigFile = errors.New("config: failed to read config file")
+	ErrBadValue   = errors.New("config: bad value")
+	ErrValidate   = errors.New("config: invalid config")
+)
+
+type Config struct {
+	// Date model run date (YYYY-MM-DD, UTC). Empty date means the latest complete run
+	Date         string `yaml:"date" toml:"date"`
+	Cycle        string `yaml:"cycle" toml:"cycle"`
+	ForecastFrom int    `yaml:"forecast_from" toml:"forecast_from"`
+	ForecastTo   int    `yaml:"forecast_to" toml:"forecast_to"`
+	ForecastStep int    `yaml:"forecast_step" toml:"forecast_step"`
+	GridSize     string `yaml:"grid_size" toml:"grid_size"`
+	DSN          string `yaml:"dsn" toml:"dsn"`
+	// Catalog variable catalog file. Empty means built-in catalog
+	Catalog  string `yaml:"catalog" toml:"catalog"`
+	CacheDir string `yaml:"cache_dir" toml:"cache_dir"`
+	// KeepRuns number of newest complete runs kept in storage, older runs still
+	// loading and the loaded run are kept too. 0 keeps all runs
+	KeepRuns int `yaml:"keep_runs" toml:"keep_runs"`
+	// Region stored area: "minLng,minLat,maxLng,maxLat", WKT, GeoJSON or file with one of them
+	Region string `yaml:"region" toml:"region"`
+	// Workers forecast hours loaded concurrently. Every hour keeps its fields
+	// in memory and holds a database connection while it is stored
+	Workers int `yaml:"workers" toml:"workers"`
+	// MaxConnections concurrent requests of every source host unless Limits sets connections
+	MaxConnections int `yaml:"max_connections" toml:"max_connections"`
+	MaxRetries     int `yaml:"max_retries" toml:"max_retries"`
+	// Limits request limits of every source host, e.g. "rate=120/m,connections=4,bandwidth=20M". Empty means only MaxConnections
+	Limits string `yaml:"limits" toml:"limits"`
+	// HostLimits limits of hosts overriding Limits: "host limits; host limits"
+	HostLimits string `yaml:"host_limits" toml:"host_limits"`
+	// Source where GRIB files are read from: nomads, s3 or local
+	Source string `yaml:"source" toml:"source"`
+	// BaseURL NOMADS URL, used by nomads source
+	BaseURL     string `yaml:"base_url" toml:"base_url"`
+	S3Endpoint  string `yaml:"s3_endpoint" toml:"s3_endpoint"`
+	S3Bucket    string `yaml:"s3_bucket" toml:"s3_bucket"`
+	S3Prefix    string `yaml:"s3_prefix" toml:"s3_prefix"`
+	S3Region    string `yaml:"s3_region" toml:"s3_region"`
+	S3AccessKey string `yaml:"s3_access_key" toml:"s3_access_key"`
+	S3SecretKey string `yaml:"s3_secret_key" toml:"s3_secret_key"`
+	// SourceDir directory of local source
+	SourceDir string `yaml:"source_dir" toml:"source_dir"`
+	// WaveGrid GFS-Wave global grid: 0p16 or 0p25. Empty disables wave variables
+	WaveGrid string `yaml:"wave_grid" toml:"wave_grid"`
+	// Levels comma-separated isobaric levels (hPa) of isobaric variables. Empty disables them
+	Levels string `yaml:"levels" toml:"levels"`
+	// Mode download mode: idx or filter
+	Mode string `yaml:"mode" toml:"mode"`
+	// RangeGap idx mode: byte ranges separated by not more than RangeGap bytes are fetched by one request
+	RangeGap int `yaml:"range_gap" toml:"range_gap"`
+	// FilterURL NOMADS grib-filter CGI base URL
+	FilterURL string `yaml:"filter_url" toml:"filter_url"`
+	// FilterProduct grib-filter product. Empty means GFS product of grid size
+	FilterProduct string `yaml:"filter_product" toml:"filter_product"`
+	// Lookback number of cycles probed when searching the latest run
+	Lookback int `yaml:"lookback" toml:"lookback"`
+	// PollInterval delay between checks for new forecast hours in serve mode
+	PollInterval Duration `yaml:"poll_interval" toml:"poll_interval"`
+}
+
+// Default return config with built-in values
+func Default() Config {
+	return Config{
+		ForecastFrom:   0,
+		ForecastTo:     9,
+		ForecastStep:   3,
+		GridSize:       string(noaa.GridSize0p50),
+		DSN:            "host=localhost port=5555 user=postgres dbname=weather password=postgres sslmode=disable",
+		CacheDir:       "grib",
+		Workers:        4,
+		MaxConnections: 3,
+		MaxRetries:     download.DefaultMaxRetries,
+		HostLimits:     "nomads.ncep.noaa.gov rate=100/m,burst=10",
+		Source:         SourceNOMADS,
+		BaseURL:        noaa.BaseURL,
+		S3Endpoint:     source.DefaultS3Endpoint,
+		S3Bucket:       source.DefaultS3Bucket,
+		S3Region:       source.DefaultS3Region,
+		Mode:           ModeIdx,
+		RangeGap:       512 << 10,
+		FilterURL:      noaa.FilterBaseURL,
+		Lookback:       noaa.DefaultLookback,
+		PollInterval:   Duration(5 * time.Minute),
+	}
+}
+
+type option struct {
+	name  string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+func intSetter(field func(c *Config) *int) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = i
+		return nil
+	}
+}
+
+// Duration time.Duration read from "90s", "5m" style strings
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func durationSetter(field func(c *Config) *Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		return field(c).UnmarshalText([]byte(v))
+	}
+}
+
+func stringSetter(field func(c *Config) *string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+var options = []option{
+	{"date", "model run date YYYY-MM-DD (UTC), latest complete run if empty", stringSetter(func(c *Config) *string { return &c.Date })},
+	{"cycle", "model cycle: 00, 06, 12 or 18", stringSetter(func(c *Config) *string { return &c.Cycle })},
+	{"forecast-from", "first forecast hour", intSetter(func(c *Config) *int { return &c.ForecastFrom })},
+	{"forecast-to", "last forecast hour (inclusive)", intSetter(func(c *Config) *int { return &c.ForecastTo })},
+	{"forecast-step", "forecast hours step", intSetter(func(c *Config) *int { return &c.ForecastStep })},
+	{"grid-size", "grid size: 0p25, 0p50 or 1p00", stringSetter(func(c *Config) *string { return &c.GridSize })},
+	{"dsn", "postgres DSN", stringSetter(func(c *Config) *string { return &c.DSN })},
+	{"catalog", "variable catalog file (built-in catalog if empty)", stringSetter(func(c *Config) *string { return &c.Catalog })},
+	{"keep-runs", "number of newest complete runs kept in storage (runs still loading are kept too), 0 keeps all", intSetter(func(c *Config) *int { return &c.KeepRuns })},
+	{"region", "store only cells intersecting bbox \"minLng,minLat,maxLng,maxLat\", WKT/GeoJSON polygon or file", stringSetter(func(c *Config) *string { return &c.Region })},
+	{"cache-dir", "directory for downloaded GRIB files", stringSetter(func(c *Config) *string { return &c.CacheDir })},
+	{"workers", "forecast hours loaded concurrently", intSetter(func(c *Config) *int { return &c.Workers })},
+	{"max-connections", "concurrent requests of every source host, connections of limits override it", intSetter(func(c *Config) *int { return &c.MaxConnections })},
+	{"max-retries", "download retries on 5xx, 429, NOMADS 403 and network errors", intSetter(func(c *Config) *int { return &c.MaxRetries })},
+	{"limits", "request limits of every source host: \"rate=120/m,burst=10,connections=4,bandwidth=20M\", only max-connections if empty", stringSetter(func(c *Config) *string { return &c.Limits })},
+	{"host-limits", "limits of hosts overriding limits: \"host rate=100/m,burst=10; host2 bandwidth=5M\"", stringSetter(func(c *Config) *string { return &c.HostLimits })},
+	{"source", "GRIB source: nomads, s3 or local", stringSetter(func(c *Config) *string { return &c.Source })},
+	{"base-url", "nomads source: GFS data base URL", stringSetter(func(c *Config) *string { return &c.BaseURL })},
+	{"s3-endpoint", "s3 source: endpoint URL", stringSetter(func(c *Config) *string { return &c.S3Endpoint })},
+	{"s3-bucket", "s3 source: bucket", stringSetter(func(c *Config) *string { return &c.S3Bucket })},
+	{"s3-prefix", "s3 source: key prefix of gfs.YYYYMMDD directories", stringSetter(func(c *Config) *string { return &c.S3Prefix })},
+	{"s3-region", "s3 source: region", stringSetter(func(c *Config) *string { return &c.S3Region })},
+	{"s3-access-key", "s3 source: access key, anonymous access if empty", stringSetter(func(c *Config) *string { return &c.S3AccessKey })},
+	{"s3-secret-key", "s3 source: secret key", stringSetter(func(c *Config) *string { return &c.S3SecretKey })},
+	{"source-dir", "local source: directory with NOMADS layout", stringSetter(func(c *Config) *string { return &c.SourceDir })},
+	{"wave-grid", "GFS-Wave grid for wave variables: 0p16 or 0p25, disabled if empty", stringSetter(func(c *Config) *string { return &c.WaveGrid })},
+	{"levels", "isobaric levels (hPa) for pressure-level variables, e.g. \"1000,850,500\", disabled if empty", stringSetter(func(c *Config) *string { return &c.Levels })},
+	{"mode", "download mode: idx (byte ranges) or filter (NOMADS grib-filter)", stringSetter(func(c *Config) *string { return &c.Mode })},
+	{"range-gap", "idx mode: fetch byte ranges separated by not more than this many bytes in one request", intSetter(func(c *Config) *int { return &c.RangeGap })},
+	{"filter-url", "filter mode: grib-filter CGI base URL", stringSetter(func(c *Config) *string { return &c.FilterURL })},
+	{"filter-product", "filter mode: gfs_0p25, gfs_0p50, gfs_1p00 or fnl (product of grid-size if empty)", stringSetter(func(c *Config) *string { return &c.FilterProduct })},
+	{"lookback", "cycles to probe when searching the latest run", intSetter(func(c *Config) *int { return &c.Lookback })},
+	{"poll-interval", "serve mode: delay between checks for new data", durationSetter(func(c *Config) *Duration { return &c.PollInterval })},
+}
+
+func envName(optionName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(optionName, "-", "_"))
+}
+
+// Load build config from defaults, config file, environment and args
+func Load(name string, args []string) (*Config, error) {
+	return LoadWith(name, args, nil)
+}
+
+// LoadWith build config as Load, command flags are registered by register
+func LoadWith(name string, args []string, register func(fs *flag.FlagSet)) (*Config, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [serve|inventory] [flags]\n", name)
+		fs.PrintDefaults()
+	}
+	if register != nil {
+		register(fs)
+	}
+	configPath := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "path to YAML or TOML config file (env "+envPrefix+"CONFIG)")
+	for _, o := range options {
+		fs.String(o.name, "", fmt.Sprintf("%s (env %s)", o.usage, envName(o.name)))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	if *configPath != "" {
+		if err := cfg.readFile(*configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, o := range options {
+		if v, ok := os.LookupEnv(envName(o.name)); ok {
+			if err := o.set(&cfg, v); err != nil {
+				return nil, fmt.Errorf("%w: %s=%q: %w", ErrBadValue, envName(o.name), v, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, o := range options {
+			if o.name == f.Name {
+				if err := o.set(&cfg, f.Value.String()); err != nil {
+					flagErr = errors.Join(flagErr, fmt.Errorf("%w: -%s=%q: %w", ErrBadValue, f.Name, f.Value, err))
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Join(ErrConfigFile, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return errors.Join(ErrConfigFile, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		err = fmt.Errorf("unsupported config format %q", filepath.Ext(path))
+	}
+
+	if err != nil {
+		return errors.Join(ErrConfigFile, err)
+	}
+	return nil
+}
+
+// Validate check config values
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Date != "" {
+		if _, err := time.Parse(dateFormat, c.Date); err != nil {
+			errs = append(errs, fmt.Errorf("date %q: expected YYYY-MM-DD", c.Date))
+		}
+		if _, err := noaa.ParseModelCycle(c.Cycle); err != nil {
+			errs = append(errs, err)
+		}
+	} else if c.Cycle != "" {
+		errs = append(errs, errors.New("cycle requires date"))
+	}
+
+	if _, err := noaa.ParseGridSize(c.GridSize); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.ForecastFrom < 0 || c.ForecastFrom > maxForecastHour {
+		errs = append(errs, fmt.Errorf("forecast-from %d: expected 0..%d", c.ForecastFrom, maxForecastHour))
+	}
+	if c.ForecastTo < c.ForecastFrom || c.ForecastTo > maxForecastHour {
+		errs = append(errs, fmt.Errorf("forecast-to %d: expected %d..%d", c.ForecastTo, c.ForecastFrom, maxForecastHour))
+	}
+	if c.ForecastStep <= 0 {
+		errs = append(errs, fmt.Errorf("forecast-step %d: must be positive", c.ForecastStep))
+	}
+
+	if c.DSN == "" {
+		errs = append(errs, errors.New("dsn is required"))
+	}
+	if c.KeepRuns < 0 {
+		errs = append(errs, fmt.Errorf("keep-runs %d: must not be negative", c.KeepRuns))
+	}
+	if c.CacheDir == "" {
+		errs = append(errs, errors.New("cache-dir is required"))
+	}
+	if c.Workers <= 0 {
+		errs = append(errs, fmt.Errorf("workers %d: must be positive", c.Workers))
+	}
+	if c.MaxConnections <= 0 {
+		errs = append(errs, fmt.Errorf("max-connections %d: must be positive", c.MaxConnections))
+	}
+	if c.MaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("max-retries %d: must not be negative", c.MaxRetries))
+	}
+	if _, err := c.parseLimiter(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.RangeGap < 0 {
+		errs = append(errs, fmt.Errorf("range-gap %d: must not be negative", c.RangeGap))
+	}
+	switch c.Source {
+	case SourceNOMADS:
+		if c.BaseURL == "" {
+			errs = append(errs, errors.New("base-url is required"))
+		}
+	case SourceS3:
+		if c.S3Endpoint == "" || c.S3Bucket == "" {
+			errs = append(errs, errors.New("s3-endpoint and s3-bucket are required"))
+		}
+	case SourceLocal:
+		if c.SourceDir == "" {
+			errs = append(errs, errors.New("source-dir is required"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("source %q: expected %s, %s or %s", c.Source, SourceNOMADS, SourceS3, SourceLocal))
+	}
+	if c.WaveGrid != "" {
+		if _, err := noaa.ParseWaveGridSize(c.WaveGrid); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if _, err := parseLevels(c.Levels); err != nil {
+		errs = append(errs, err)
+	}
+
+	switch c.Mode {
+	case ModeIdx:
+	case ModeFilter:
+		if c.Source != SourceNOMADS {
+			errs = append(errs, fmt.Errorf("mode %s: requires source %s", ModeFilter, SourceNOMADS))
+		}
+		if c.FilterURL == "" {
+			errs = append(errs, errors.New("filter-url is required"))
+		}
+		if c.FilterProduct != "" {
+			p, err := noaa.ParseFilterProduct(c.FilterProduct)
+			if err != nil {
+				errs = append(errs, err)
+			} else if p.GridSize() != noaa.GridSize(c.GridSize) {
+				errs = append(errs, fmt.Errorf("filter-product %s: grid differs from grid-size %s", p, c.GridSize))
+			}
+		}
+	default:
+		errs = append(errs, fmt.Errorf("mode %q: expected %s or %s", c.Mode, ModeIdx, ModeFilter))
+	}
+
+	if c.Lookback <= 0 {
+		errs = append(errs, fmt.Errorf("lookback %d: must be positive", c.Lookback))
+	}
+
+	if c.PollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("poll-interval %s: must be positive", c.PollInterval))
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(append([]error{ErrValidate}, errs...)...)
+	}
+	return nil
+}
+
+// Wave return GFS-Wave grid. ok is false when wave variables are disabled. Call after Validate
+func (c *Config) Wave() (gridSize noaa.GridSize, ok bool) {
+	if c.WaveGrid == "" {
+		return "", false
+	}
+	return noaa.GridSize(c.WaveGrid), true
+}
+
+// IsobaricLevels return isobaric levels (hPa). Empty when isobaric variables are disabled. Call after Validate
+func (c *Config) IsobaricLevels() []int {
+	levels, _ := parseLevels(c.Levels)
+	return levels
+}
+
+func parseLevels(v string) ([]int, error) {
+	if strings.TrimSpace(v) == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(v, ",")
+	levels := make([]int, 0, len(parts))
+	seen := make(map[int]struct{}, len(parts))
+	for _, p := range parts {
+		level, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || level <= 0 || level > maxLevel {
+			return nil, fmt.Errorf("levels %q: expected hPa values 1..%d", v, maxLevel)
+		}
+		if _, ok := seen[level]; ok {
+			return nil, fmt.Errorf("levels %q: duplicate level %d", v, level)
+		}
+		seen[level] = struct{}{}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// Product return grib-filter product. Call after Validate
+func (c *Config) Product() noaa.FilterProduct {
+	if c.FilterProduct == "" {
+		return noaa.FilterProductFor(c.Grid())
+	}
+	return noaa.FilterProduct(c.FilterProduct)
+}
+
+// Run return model run. ok is false when run date is not set. Call after Validate
+func (c *Config) Run() (run noaa.Run, ok bool) {
+	if c.Date == "" {
+		return noaa.Run{}, false
+	}
+	date, _ := time.Parse(dateFormat, c.Date)
+	cycle, _ := noaa.ParseModelCycle(c.Cycle)
+	return noaa.Run{Date: date, Cycle: cycle}, true
+}
+
+// Grid return grid size. Call after Validate
+func (c *Config) Grid() noaa.GridSize {
+	g, _ := noaa.ParseGridSize(c.GridSize)
+	return g
+}
+
+// ForecastHours return forecast hours to load
+func (c *Config) ForecastHours() []int {
+	hours := make([]int, 0, (c.ForecastTo-c.ForecastFrom)/c.ForecastStep+1)
+	for h := c.ForecastFrom; h <= c.ForecastTo; h += c.ForecastStep {
+		hours = append(hours, h)
+	}
+	return hours
+}
+
+// Limiter return limiter of source hosts. Call after Validate
+func (c *Config) Limiter() *download.Limiter {
+	limiter, _ := c.parseLimiter()
+	return limiter
+}
+
+func (c *Config) parseLimiter() (*download.Limiter, error) {
+	def, err := download.ParseLimits(c.Limits, download.Limits{Connections: c.MaxConnections})
+	if err != nil {
+		return nil, fmt.Errorf("limits %q: %w", c.Limits, err)
+	}
+	limiter := download.NewLimiter(def)
+
+	for _, entry := range strings.Split(c.HostLimits, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, limits, _ := strings.Cut(entry, " ")
+		hostLimits, err := download.ParseLimits(limits, def)
+		if err != nil {
+			return nil, fmt.Errorf("host-limits %q: %w", entry, err)
+		}
+		limiter.Hosts[host] = hostLimits
+	}
+
+	// NOMADS answers 403 to clients over its request rate
+	for _, nomads := range []string{c.BaseURL, c.FilterURL} {
+		if u, err := url.Parse(nomads); err == nil && u.Host != "" {
+			limiter.ForbiddenHosts[u.Host] = true
+		}
+	}
+	return limiter, nil
+}
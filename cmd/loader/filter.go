@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+
+	"gfsloader/internal/grid"
+	"gfsloader/utils/indexfile"
+	"gfsloader/utils/noaa"
+)
+
+// newFilter create grib-filter request of layers cut to the region bounding box
+func (l *loader) newFilter(layers []message) *noaa.Filter {
+	var variables, levels []string
+	seen := make(map[string]bool, 2*len(layers))
+	for _, layer := range layers {
+		if !seen["var:"+layer.param] {
+			seen["var:"+layer.param] = true
+			variables = append(variables, layer.param)
+		}
+		if !seen["lev:"+layer.layer] {
+			seen["lev:"+layer.layer] = true
+			levels = append(levels, layer.layer)
+		}
+	}
+
+	filter := noaa.NewFilter(l.cfg.Product(), variables, levels)
+	filter.BaseURL = l.cfg.FilterURL
+
+	if l.region != nil {
+		// one cell margin keeps cells on the region border
+		margin := float64(l.cfg.Grid().Degrees())
+		minLng, minLat, maxLng, maxLat := l.region.BBox()
+		if maxLng-minLng+2*margin < 360 {
+			filter.Subregion = &noaa.Subregion{
+				LeftLon:   minLng - margin,
+				RightLon:  maxLng + margin,
+				TopLat:    math.Min(maxLat+margin, 90),
+				BottomLat: math.Max(minLat-margin, -90),
+			}
+		}
+	}
+
+	return filter
+}
+
+// fetchFiltered download one grib-filter subset of forecast hour and decode it.
+// The subset keeps message order of the source file, so messages are matched
+// to layers with the .idx of the product
+func (l *loader) fetchFiltered(ctx context.Context, run noaa.Run, forecastTime int, gribBaseFileName string, layers []message) ([]*grid.Field, int64, error) {
+	filter := l.newFilter(layers)
+	dir, file := filter.Product.Path(run, forecastTime)
+
+	url := l.cfg.BaseURL + dir + "/" + file
+	indexFileName := gribBaseFileName + "_filter.idx"
+	if _, err := os.Stat(indexFileName); errors.Is(err, os.ErrNotExist) {
+		err := l.downloader.Download(ctx, "Get index file", indexFileName, url+".idx", 0, 0)
+		if err != nil {
+			return nil, 0, errors.Join(ErrProcess, err)
+		}
+	}
+
+	size, err := cachedSize(indexFileName+".size", func() (uint64, error) {
+		return l.downloader.Size(ctx, url)
+	})
+	if err != nil {
+		return nil, 0, errors.Join(ErrProcess, err)
+	}
+
+	idxFile, err := indexfile.New(indexFileName, size)
+	if err != nil {
+		return nil, 0, errors.Join(ErrProcess, err)
+	}
+
+	count, positions, err := filteredMessages(idxFile, filter, layers)
+	if err != nil {
+		return nil, 0, errors.Join(ErrProcess, err)
+	}
+
+	gribFile := gribBaseFileName + "_filter"
+	if _, err := os.Stat(gribFile); errors.Is(err, os.ErrNotExist) {
+		err = l.downloader.Download(ctx, fmt.Sprintf("Get filtered forecast %03d", forecastTime), gribFile, filter.URL(run, forecastTime), 0, 0)
+		if err != nil {
+			return nil, 0, errors.Join(ErrProcess, err)
+		}
+	}
+
+	st, err := os.Stat(gribFile)
+	if err != nil {
+		return nil, 0, errors.Join(ErrProcess, err)
+	}
+
+	subset, err := getGribFields(gribFile)
+	if err != nil {
+		return nil, 0, errors.Join(ErrProcess, err)
+	}
+
+	if len(subset) != count {
+		return nil, 0, errors.Join(ErrProcess, fmt.Errorf("filtered file has %d messages, index expects %d", len(subset), count))
+	}
+
+	fields := make([]*grid.Field, len(layers))
+	for n := range layers {
+		fields[n] = subset[positions[n]]
+	}
+
+	return fields, st.Size(), nil
+}
+
+// filteredMessages return count of messages of grib-filter subset and positions
+// of messages of layers within it. The subset holds every message of selected
+// variables and levels in file order: keys repeat for instant values and
+// forecast windows (e.g. CRAIN:surface). Layer is the first message of its
+// param:level, as in idx mode
+func filteredMessages(idx *indexfile.IndexFile, filter *noaa.Filter, layers []message) (int, []int, error) {
+	var order []indexfile.Entry
+	for _, e := range idx.Entries() {
+		if filter.Match(e.Param, e.Level) {
+			order = append(order, e)
+		}
+	}
+
+	positions := make([]int, len(layers))
+	for n, layer := range layers {
+		k := -1
+		if first := idx.Messages(layer.param, layer.layer); len(first) > 0 {
+			k = slices.IndexFunc(order, func(e indexfile.Entry) bool {
+				return e.Key() == first[0].Key() && e.Forecast == first[0].Forecast
+			})
+		}
+		if k < 0 {
+			return 0, nil, fmt.Errorf("\"%s-%s\": %w", layer.param, layer.layer, indexfile.ErrOffsetNotFound)
+		}
+		positions[n] = k
+	}
+	return len(order), positions, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"gfsloader/utils/indexfile"
+	"gfsloader/utils/noaa"
+)
+
+// filterIndex .idx of GFS forecast hour 6 where surface keys repeat for
+// instant values and 0-6 hour windows
+const filterIndex = `1:0:d=2024010200:PRMSL:mean sea level:6 hour fcst:
+2:1000:d=2024010200:TMP:2 m above ground:6 hour fcst:
+3:2000:d=2024010200:CRAIN:surface:6 hour fcst:
+4:3000:d=2024010200:CRAIN:surface:0-6 hour ave fcst:
+5:4000:d=2024010200:PRATE:surface:6 hour fcst:
+6:5000:d=2024010200:PRATE:surface:0-6 hour ave fcst:
+7:6000:d=2024010200:LAND:surface:6 hour fcst:
+8:7000:d=2024010200:TMP:500 mb:6 hour fcst:
+`
+
+func TestFilteredMessages(t *testing.T) {
+	idx, err := indexfile.Parse(strings.NewReader(filterIndex), 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		layers    []message
+		count     int
+		positions []int
+		wantErr   error
+	}{
+		{
+			name:      "single keys",
+			layers:    []message{landMask, {param: "PRMSL", layer: "mean sea level"}},
+			count:     2,
+			positions: []int{1, 0},
+		},
+		{
+			// CRAIN and PRATE at surface select both messages of every key
+			name:      "repeated keys",
+			layers:    []message{landMask, {param: "CRAIN", layer: "surface"}, {param: "PRATE", layer: "surface"}},
+			count:     5,
+			positions: []int{4, 0, 2},
+		},
+		{
+			// TMP and 2 m above ground select only TMP:2 m above ground
+			name:      "variable and level of different layers",
+			layers:    []message{landMask, {param: "TMP", layer: "2 m above ground"}, {param: "CRAIN", layer: "surface"}},
+			count:     4,
+			positions: []int{3, 0, 1},
+		},
+		{
+			name:    "missing layer",
+			layers:  []message{landMask, {param: "TMP", layer: "850 mb"}},
+			wantErr: indexfile.ErrOffsetNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var variables, levels []string
+			for _, layer := range tt.layers {
+				if !slices.Contains(variables, layer.param) {
+					variables = append(variables, layer.param)
+				}
+				if !slices.Contains(levels, layer.layer) {
+					levels = append(levels, layer.layer)
+				}
+			}
+			filter := noaa.NewFilter(noaa.FilterGFS0p25, variables, levels)
+
+			count, positions, err := filteredMessages(idx, filter, tt.layers)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.count {
+				t.Errorf("count %d, want %d", count, tt.count)
+			}
+			if !slices.Equal(positions, tt.positions) {
+				t.Errorf("positions %v, want %v", positions, tt.positions)
+			}
+		})
+	}
+}
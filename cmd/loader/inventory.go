@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gfsloader/cmd/loader/config"
+	"gfsloader/internal/source"
+	"gfsloader/utils/indexfile"
+	"gfsloader/utils/noaa"
+)
+
+// inventoryFlags options of inventory command
+type inventoryFlags struct {
+	query indexfile.Query
+	// hour forecast hour, -1 means forecast-from
+	hour int
+	wave bool
+	// file local GRIB2 file listed instead of published file of run
+	file string
+}
+
+func (f *inventoryFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.query.Param, "param", "", "inventory: parameter, e.g. TMP")
+	fs.StringVar(&f.query.Level, "level", "", "inventory: level pattern, e.g. \"* mb\"")
+	fs.StringVar(&f.query.Forecast, "forecast", "", "inventory: whole forecast column, e.g. anl, \"3 hour fcst\", \"0-6 hour acc fcst\"")
+	fs.IntVar(&f.hour, "hour", -1, "inventory: forecast hour (forecast-from if negative)")
+	fs.BoolVar(&f.wave, "wave", false, "inventory: list GFS-Wave file of wave-grid")
+	fs.StringVar(&f.file, "file", "", "inventory: list local GRIB2 file, inventory is generated from its messages")
+}
+
+// runInventory print messages of GRIB file of forecast hour in wgrib2 -s format
+func runInventory(ctx context.Context, cfg *config.Config, flags inventoryFlags, w io.Writer) error {
+	if err := flags.query.Validate(); err != nil {
+		return err
+	}
+
+	if flags.file != "" {
+		return fileInventory(flags.file, flags.query, w)
+	}
+
+	hour := flags.hour
+	if hour < 0 {
+		hour = cfg.ForecastFrom
+	}
+
+	downloader := newDownloader(cfg)
+	downloader.ShowProgress = false
+
+	model, gridSize, suffix := noaa.ModelAtmo, cfg.Grid(), ""
+	if flags.wave {
+		waveGrid, ok := cfg.Wave()
+		if !ok {
+			return fmt.Errorf("wave inventory requires wave-grid")
+		}
+		model, gridSize, suffix = noaa.ModelWave, waveGrid, "_wave"
+	}
+	src := newSource(cfg, downloader, model, gridSize)
+
+	run, ok := cfg.Run()
+	if !ok {
+		var err error
+		run, err = source.Latest(ctx, src, []int{hour}, time.Now(), cfg.Lookback)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(cfg.CacheDir, 0760); err != nil {
+		return err
+	}
+	indexFileName := filepath.Join(cfg.CacheDir, fmt.Sprintf("%s_%d%s.idx", runCacheName(cfg, run), hour, suffix))
+	idx, err := loadIndex(ctx, src, run, hour, indexFileName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "# %s\n", src.Location(run, hour))
+	for _, e := range idx.Find(flags.query) {
+		fmt.Fprintln(w, e)
+	}
+	return nil
+}
+
+// fileInventory print messages of GRIB2 file scanned section by section
+func fileInventory(fileName string, query indexfile.Query, w io.Writer) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	idx, err := indexfile.Generate(file)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "# %s\n", fileName)
+	for _, e := range idx.Find(query) {
+		fmt.Fprintln(w, e)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import "sync"
+
+// cacheFiles locks of cache files. Forecast hours are loaded concurrently and
+// the accumulator of every hour reads .idx and windows of earlier hours, so
+// the same file may be fetched by several goroutines at once
+var cacheFiles pathLocks
+
+// pathLocks mutexes by file path. Mutex is dropped when no goroutine holds
+// or waits for it
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock acquire mutex of path and return its unlock
+func (p *pathLocks) lock(path string) (unlock func()) {
+	p.mu.Lock()
+	if p.locks == nil {
+		p.locks = make(map[string]*pathLock)
+	}
+	l, ok := p.locks[path]
+	if !ok {
+		l = &pathLock{}
+		p.locks[path] = l
+	}
+	l.refs++
+	p.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		p.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(p.locks, path)
+		}
+		p.mu.Unlock()
+	}
+}
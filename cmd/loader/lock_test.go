@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestPathLocks(t *testing.T) {
+	var (
+		locks   pathLocks
+		wg      sync.WaitGroup
+		holders = map[string]int{}
+		mu      sync.Mutex
+	)
+	for n := 0; n < 64; n++ {
+		path := []string{"a.idx", "b.idx"}[n%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locks.lock(path)
+			defer unlock()
+
+			mu.Lock()
+			holders[path]++
+			if holders[path] > 1 {
+				t.Errorf("%s is held by %d goroutines", path, holders[path])
+			}
+			mu.Unlock()
+
+			mu.Lock()
+			holders[path]--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(locks.locks) != 0 {
+		t.Errorf("%d mutexes left after unlock", len(locks.locks))
+	}
+}
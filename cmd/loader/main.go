@@ -3,71 +3,109 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
-	"strconv"
 	"sync"
 	"time"
 
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
+	"gfsloader/cmd/loader/config"
+	"gfsloader/internal/catalog"
+	"gfsloader/internal/grid"
 	"gfsloader/internal/models"
+	"gfsloader/internal/region"
+	"gfsloader/internal/source"
 	"gfsloader/internal/storage/postgres"
+	pgModels "gfsloader/internal/storage/postgres/models"
+	"gfsloader/utils/download"
 	"gfsloader/utils/indexfile"
 	"gfsloader/utils/noaa"
 
-	"github.com/nilsmagnus/grib/griblib"
 	"github.com/schollz/progressbar/v3"
+	"golang.org/x/sync/errgroup"
 )
 
 var (
-	ErrProcess  = errors.New("process error")
-	ErrDownload = errors.New("download error")
+	ErrProcess   = errors.New("process error")
+	ErrInitGrid  = errors.New("failed to init database grid table")
+	ErrLatestRun = errors.New("failed to find latest run")
 )
 
-func download(label string, destinationPath, downloadURL string, from, to uint64) error {
-	tempDestinationPath := destinationPath + ".tmp"
-	req, err := http.NewRequest("GET", downloadURL, nil)
-	if err != nil {
-		return err
-	}
+type loader struct {
+	cfg     *config.Config
+	catalog *catalog.Catalog
+	// region stored cells. nil means whole globe
+	region          *region.Region
+	storageProvider *postgres.PostgresDataProvider
+	downloader      *download.Downloader
+	source          source.Source
+	// waveSource GFS-Wave files, nil when wave variables are not loaded
+	waveSource source.Source
+}
 
-	if from != 0 || to != 0 {
-		end := ""
-		if to != 0 {
-			end = fmt.Sprint(to)
-		}
-		req.Header.Set("range", fmt.Sprintf("bytes=%d-%s", from, end))
+func newLoader(cfg *config.Config, cat *catalog.Catalog, reg *region.Region, storageProvider *postgres.PostgresDataProvider) *loader {
+	downloader := newDownloader(cfg)
+
+	l := &loader{
+		cfg:             cfg,
+		catalog:         cat,
+		region:          reg,
+		storageProvider: storageProvider,
+		downloader:      downloader,
+		source:          newSource(cfg, downloader, noaa.ModelAtmo, cfg.Grid()),
 	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	if waveGrid, ok := cfg.Wave(); ok {
+		l.waveSource = newSource(cfg, downloader, noaa.ModelWave, waveGrid)
 	}
 
-	defer resp.Body.Close()
+	return l
+}
 
-	switch resp.StatusCode {
-	case 200, 206:
-		f, _ := os.OpenFile(tempDestinationPath, os.O_CREATE|os.O_WRONLY, 0644)
+// newDownloader create downloader with configured retries and limits of source hosts
+func newDownloader(cfg *config.Config) *download.Downloader {
+	downloader := download.New()
+	downloader.MaxRetries = cfg.MaxRetries
+	limiter := cfg.Limiter()
+	downloader.Client = &http.Client{Transport: limiter.Transport(nil)}
+	downloader.ThrottlesForbidden = limiter.ThrottlesForbidden
+	return downloader
+}
 
-		bar := progressbar.DefaultBytes(
-			resp.ContentLength,
-			label,
-		)
-		io.Copy(io.MultiWriter(f, bar), resp.Body)
-		f.Close()
-		os.Rename(tempDestinationPath, destinationPath)
-		return nil
+// newSource create configured GRIB source
+func newSource(cfg *config.Config, downloader *download.Downloader, model noaa.Model, gridSize noaa.GridSize) source.Source {
+	switch cfg.Source {
+	case config.SourceS3:
+		s := source.NewS3(source.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Bucket:    cfg.S3Bucket,
+			Prefix:    cfg.S3Prefix,
+			Region:    cfg.S3Region,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		}, gridSize, downloader)
+		s.Model = model
+		return s
+	case config.SourceLocal:
+		s := source.NewLocal(cfg.SourceDir, gridSize)
+		s.Model = model
+		return s
 	default:
-		return errors.Join(ErrDownload, fmt.Errorf("status code: %d : %s", resp.StatusCode, downloadURL))
+		s := source.NewNOMADS(cfg.BaseURL, gridSize, downloader)
+		s.Model = model
+		return s
 	}
-
 }
 
-func getGribMessages(fileName string) ([]*griblib.Message, error) {
+// getGribFields decode every message of GRIB file
+func getGribFields(fileName string) ([]*grid.Field, error) {
 	gribfile, err := os.Open(fileName)
 	if err != nil {
 		return nil, err
@@ -75,90 +113,239 @@ func getGribMessages(fileName string) ([]*griblib.Message, error) {
 
 	defer gribfile.Close()
 
-	messages, err := griblib.ReadMessages(gribfile)
-	if err != nil {
-		return nil, err
-	}
-
-	return messages, nil
+	return grid.ReadFields(gribfile)
 }
 
 type message struct {
+	name  string
 	param string
 	layer string
 }
 
-type Records map[string]map[string]float64
-
-func processData(day, month, year, forecastTime int, cycle noaa.ModelCycle, rate chan struct{}) (Records, error) {
-	gribURL := noaa.URLBuilder(noaa.ModelAtmo, day, month, year, cycle, forecastTime, noaa.GridSize0p50)
-	idxURL := gribURL + ".idx"
-
-	fName := fmt.Sprintf("%d_%d_%d_%d", year, month, day, forecastTime)
-
-	layers := []message{
-		{
-			param: "PRMSL",
-			layer: "mean sea level",
-		},
-		{
-			param: "LAND",
-			layer: "surface",
-		},
-		{
-			param: "TMP",
-			layer: "2 m above ground",
-		},
-		{
-			param: "UGRD",
-			layer: "10 m above ground",
-		},
-		{
-			param: "VGRD",
-			layer: "10 m above ground",
-		},
-		{
-			param: "RH",
-			layer: "2 m above ground",
-		},
-		{
-			param: "CRAIN",
-			layer: "surface",
-		},
-		{
-			param: "VIS",
-			layer: "surface",
-		},
-	}
-
-	layersCount := len(layers)
-
-	wd, err := os.Getwd()
+// landMask land/sea mask stored as IsGround of every record
+var landMask = message{
+	name:  "land",
+	param: "LAND",
+	layer: "surface",
+}
+
+// Fields decoded fields of one forecast hour. Values are aligned with catalog
+// variables, nil for isobaric variables. LevelValues hold a slice aligned with
+// catalog variables for every isobaric level of Levels, nil for surface variables
+type Fields struct {
+	Land        *grid.Field
+	Values      []*grid.Field
+	Levels      []int
+	LevelValues [][]*grid.Field
+	// Bytes size of GRIB files the fields are read from
+	Bytes int64
+}
+
+// sourceURLs return GRIB and index file locations of forecast hour
+func (l *loader) sourceURLs(run noaa.Run, forecastTime int) []string {
+	gribURL := l.source.Location(run, forecastTime)
+	urls := []string{gribURL + ".idx", gribURL}
+	if l.waveSource != nil {
+		waveURL := l.waveSource.Location(run, forecastTime)
+		urls = append(urls, waveURL+".idx", waveURL)
+	}
+	return urls
+}
+
+func (l *loader) processData(ctx context.Context, run noaa.Run, forecastTime int) (*Fields, error) {
+	cfg := l.cfg
+
+	fName := fmt.Sprintf("%s_%d", runCacheName(cfg, run), forecastTime)
+
+	levels := cfg.IsobaricLevels()
+
+	layers := make([]message, 0, len(l.catalog.Variables)+1)
+	layers = append(layers, landMask)
+	var waveLayers []message
+	for _, v := range l.catalog.Variables {
+		m := message{
+			name:  v.Name,
+			param: v.Param,
+			layer: v.Level,
+		}
+		switch {
+		case v.Accumulated(), v.Derived():
+			// read by accumulator, computed from other variables
+		case v.Model == catalog.ModelWave:
+			waveLayers = append(waveLayers, m)
+		case v.Isobaric():
+			for _, hPa := range levels {
+				m.layer = v.Layer(hPa)
+				layers = append(layers, m)
+			}
+		default:
+			layers = append(layers, m)
+		}
+	}
+
+	err := os.MkdirAll(cfg.CacheDir, 0760)
 	if err != nil {
-		panic(err)
+		return nil, errors.Join(ErrProcess, err)
 	}
 
-	tempDir := filepath.Join(wd, "grib")
+	gribBaseFileName := filepath.Join(cfg.CacheDir, fName)
+
+	var (
+		fields []*grid.Field
+		bytes  int64
+	)
+	if cfg.Mode == config.ModeFilter {
+		fields, bytes, err = l.fetchFiltered(ctx, run, forecastTime, gribBaseFileName, layers)
+	} else {
+		fields, bytes, err = l.fetchRanges(ctx, l.source, run, forecastTime, gribBaseFileName, layers)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	err = os.Mkdir(tempDir, 0760)
-	if err != nil && !os.IsExist(err) {
-		panic(err)
+	for n, field := range fields[1:] {
+		if !field.Aligned(fields[0]) {
+			return nil, errors.Join(ErrProcess, fmt.Errorf("\"%s-%s\" grid differs from land mask grid", layers[n+1].param, layers[n+1].layer))
+		}
+	}
+	land := fields[0]
+
+	// records are cells of regular grid: fields of projected grids are
+	// resampled to the nearest points of regular grid of configured step
+	if land.Projected() {
+		target := land.Cover(cfg.Grid().Degrees())
+		for n, field := range fields {
+			fields[n] = field.Resample(target)
+		}
+		land = fields[0]
 	}
 
-	gribBaseFileName := filepath.Join(tempDir, fName)
-	indexFileName := gribBaseFileName + ".idx"
+	var waveFields []*grid.Field
+	if len(waveLayers) > 0 {
+		if l.waveSource == nil {
+			return nil, errors.Join(ErrProcess, errors.New("wave variables require wave grid"))
+		}
 
-	if _, err := os.Stat(indexFileName); errors.Is(err, os.ErrNotExist) {
-		err := download("Get index file", indexFileName, idxURL, 0, 0)
+		var waveBytes int64
+		waveFields, waveBytes, err = l.fetchRanges(ctx, l.waveSource, run, forecastTime, gribBaseFileName+"_wave", waveLayers)
 		if err != nil {
-			panic(err)
+			return nil, err
+		}
+		bytes += waveBytes
+
+		for n, field := range waveFields {
+			waveFields[n] = seaOnly(field.Resample(land), land)
 		}
 	}
 
-	idxFile, err := indexfile.New(indexFileName)
+	var accFields []*grid.Field
+	acc := l.newAccumulator(run)
+	from, to := l.interval(forecastTime)
+	for _, v := range l.catalog.Variables {
+		if v.Accumulated() {
+			field, err := acc.value(ctx, v, from, to, land)
+			if err != nil {
+				return nil, err
+			}
+			accFields = append(accFields, field)
+		}
+	}
+	bytes += acc.bytes
 
+	// arrange fields in catalog order
+	values := make([]*grid.Field, len(l.catalog.Variables))
+	levelValues := make([][]*grid.Field, len(levels))
+	for k := range levelValues {
+		levelValues[k] = make([]*grid.Field, len(l.catalog.Variables))
+	}
+	atmos, wave := fields[1:], waveFields
+	for i, v := range l.catalog.Variables {
+		switch {
+		case v.Derived():
+			// computed below
+		case v.Accumulated():
+			values[i], accFields = accFields[0], accFields[1:]
+		case v.Model == catalog.ModelWave:
+			values[i], wave = wave[0], wave[1:]
+		case v.Isobaric():
+			for k := range levels {
+				levelValues[k][i], atmos = atmos[0], atmos[1:]
+			}
+		default:
+			values[i], atmos = atmos[0], atmos[1:]
+		}
+	}
+
+	l.derive(values)
+
+	return &Fields{
+		Land:        land,
+		Values:      values,
+		Levels:      levels,
+		LevelValues: levelValues,
+		Bytes:       bytes,
+	}, nil
+}
+
+// derive compute derived variables from values aligned with catalog variables.
+// Inputs are declared before derived variables, so they are computed already
+func (l *loader) derive(values []*grid.Field) {
+	index := make(map[string]int, len(l.catalog.Variables))
+	for i, v := range l.catalog.Variables {
+		index[v.Name] = i
+		if !v.Derived() {
+			continue
+		}
+
+		inputs := make([]*grid.Field, len(v.Inputs))
+		inputVars := make([]catalog.Variable, len(v.Inputs))
+		for k, name := range v.Inputs {
+			inputs[k] = values[index[name]]
+			inputVars[k] = l.catalog.Variables[index[name]]
+		}
+
+		res := *inputs[0]
+		res.Data = make([]float32, len(inputs[0].Data))
+		in := make([]float64, len(inputs))
+		for n := range res.Data {
+			for k, input := range inputs {
+				in[k] = inputVars[k].Convert(float64(input.Data[n]))
+			}
+			res.Data[n] = float32(v.Compute(in))
+		}
+		values[i] = &res
+	}
+}
+
+// seaOnly return copy of field with NaN at land cells
+func seaOnly(field, land *grid.Field) *grid.Field {
+	res := *field
+	res.Data = make([]float32, len(field.Data))
+	for n, v := range field.Data {
+		if land.Data[n] != 0 {
+			v = float32(math.NaN())
+		}
+		res.Data[n] = v
+	}
+	return &res
+}
+
+// fetchRanges download layers by .idx byte ranges and decode them. Return fields
+// aligned with layers and size of downloaded files
+func (l *loader) fetchRanges(ctx context.Context, src source.Source, run noaa.Run, forecastTime int, gribBaseFileName string, layers []message) ([]*grid.Field, int64, error) {
+	idxFile, err := loadIndex(ctx, src, run, forecastTime, gribBaseFileName+".idx")
 	if err != nil {
-		panic(err)
+		return nil, 0, err
+	}
+
+	layerFiles := make([]string, len(layers))
+	for n, layer := range layers {
+		layerFiles[n] = fmt.Sprintf("%s_%s_%s", gribBaseFileName, layer.param, layer.layer)
+	}
+
+	err = l.fetchLayers(ctx, src, run, forecastTime, gribBaseFileName, idxFile, layers, layerFiles)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	var wg sync.WaitGroup
@@ -172,129 +359,120 @@ func processData(day, month, year, forecastTime int, cycle noaa.ModelCycle, rate
 		errs = append(errs, e)
 	}
 
-	var recordsLock sync.Mutex
-	records := make(Records)
-	putRecord := func(lat, lng float32, tag string, value float64) {
-		defer recordsLock.Unlock()
-		recordsLock.Lock()
-
-		key := fmt.Sprintf("%+07d%07d%d", int(lat*100), int(lng*100), forecastTime)
-		if r, ok := records[key]; ok {
-			r[tag] = value
-		} else {
-			newR := make(map[string]float64, layersCount+2)
-			newR["lat"] = float64(lat)
-			newR["lng"] = float64(lng)
-			newR["ftime"] = float64(forecastTime)
-			newR[tag] = value
-			records[key] = newR
-		}
-	}
+	// every goroutine writes its own slot, no lock needed
+	fields := make([]*grid.Field, len(layers))
+	sizes := make([]int64, len(layers))
 
-	for _, layer := range layers {
+	for n, layer := range layers {
 		wg.Add(1)
-		go func(paramName, layerName string) {
+		go func(n int, paramName, layerName, layerGribFile string) {
 
 			defer wg.Done()
 
-			layerGribFile := fmt.Sprintf("%s_%s_%s", gribBaseFileName, paramName, layerName)
-			if _, err := os.Stat(layerGribFile); errors.Is(err, os.ErrNotExist) {
-				from, to, err := idxFile.GetOffset(paramName, layerName)
-
-				if err != nil {
-					putErr(err)
-					return
-				}
-
-				rate <- struct{}{}
-				err = download(
-					fmt.Sprintf("Get %s:%s", paramName, layerName),
-					layerGribFile,
-					gribURL,
-					from,
-					to,
-				)
-				<-rate
-
-				if err != nil {
-					putErr(err)
-					return
-				}
-			}
-
-			msgs, err := getGribMessages(layerGribFile)
+			st, err := os.Stat(layerGribFile)
 			if err != nil {
 				putErr(err)
 				return
 			}
+			sizes[n] = st.Size()
 
-			if len(msgs) == 1 {
-
-				def := msgs[0].Section3.Definition.(*griblib.Grid0)
-				data := msgs[0].Data()
-				lngStep := float32(def.Di) / 1000000.0
-				latStep := float32(def.Dj) / 1000000.0
-
-				bar := progressbar.Default(int64(len(data)), fmt.Sprintf("Load forecast %d data", forecastTime))
-
-				for j := uint32(0); j < def.Nj; j += 1 {
-					for i := uint32(0); i < def.Ni; i += 1 {
-						id := j*def.Ni + i
-
-						lng := float32(i) * lngStep
-						lat := 90.0 - float32(j)*latStep
-
-						putRecord(lat, lng, paramName, data[id])
-						bar.Add(1)
+			layerFields, err := getGribFields(layerGribFile)
+			if err != nil {
+				putErr(fmt.Errorf("\"%s-%s\": %w", paramName, layerName, err))
+				return
+			}
 
-					}
-				}
-				bar.Close()
-			} else {
+			if len(layerFields) != 1 {
 				putErr(fmt.Errorf("\"%s-%s\" has wrong message count", paramName, layerName))
 				return
 			}
+			fields[n] = layerFields[0]
 
-		}(layer.param, layer.layer)
+		}(n, layer.param, layer.layer, layerFiles[n])
 
 	}
 
 	wg.Wait()
 	if len(errs) > 1 {
-		return nil, errors.Join(errs...)
+		return nil, 0, errors.Join(errs...)
+	}
+
+	var bytes int64
+	for _, size := range sizes {
+		bytes += size
 	}
 
-	return records, nil
+	return fields, bytes, nil
 
 }
 
-func main() {
+// loadIndex download .idx of forecast hour unless cached and parse it. Size of
+// GRIB file bounds the last message, it is cached in indexFileName + ".size"
+func loadIndex(ctx context.Context, src source.Source, run noaa.Run, forecastTime int, indexFileName string) (*indexfile.IndexFile, error) {
+	defer cacheFiles.lock(indexFileName)()
 
-	ctx := context.TODO()
+	if _, err := os.Stat(indexFileName); errors.Is(err, os.ErrNotExist) {
+		err := src.FetchIndex(ctx, run, forecastTime, indexFileName)
+		if err != nil {
+			return nil, errors.Join(ErrProcess, err)
+		}
+	}
 
-	day := 29
-	month := 9
-	year := 2024
-	cycle := noaa.ModelCycle06
-	cycleInt, _ := strconv.Atoi(string(cycle))
-	// forecastTime := 0
-	gridSize := float32(0.5)
+	size, err := cachedSize(indexFileName+".size", func() (uint64, error) {
+		return src.Size(ctx, run, forecastTime)
+	})
+	if err != nil {
+		return nil, errors.Join(ErrProcess, err)
+	}
 
-	maxConnections := 3
-	rate := make(chan struct{}, maxConnections)
+	idxFile, err := indexfile.New(indexFileName, size)
+	if err != nil {
+		return nil, errors.Join(ErrProcess, err)
+	}
+	return idxFile, nil
+}
 
-	var wg sync.WaitGroup
+// cachedSize return file size saved in sizeFileName, else get it with size and save it
+func cachedSize(sizeFileName string, size func() (uint64, error)) (uint64, error) {
+	if b, err := os.ReadFile(sizeFileName); err == nil {
+		if n, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64); err == nil {
+			return n, nil
+		}
+	}
+
+	n, err := size()
+	if err != nil {
+		return 0, err
+	}
+	return n, os.WriteFile(sizeFileName, []byte(strconv.FormatUint(n, 10)), 0660)
+}
+
+func runCacheName(cfg *config.Config, run noaa.Run) string {
+	year, month, day := run.Date.Date()
+	return fmt.Sprintf("%d_%d_%d_%s_%s", year, month, day, run.Cycle, cfg.Grid())
+}
+
+// inRegion check cell centered at lat, lng is stored
+func (l *loader) inRegion(lat, lng float32) bool {
+	if l.region == nil {
+		return true
+	}
+	return l.region.IntersectsCell(float64(lat), float64(lng), float64(l.cfg.Grid().Degrees()))
+}
 
-	storageProvider := postgres.New("host=localhost port=5555 user=postgres dbname=weather password=postgres sslmode=disable")
-	storageProvider.MustRun()
-	err := storageProvider.InitGrid(ctx, func() ([]models.GridInfo, func(int)) {
+func (l *loader) initGrid(ctx context.Context) error {
+	gridSize := l.cfg.Grid().Degrees()
+	err := l.storageProvider.InitGrid(ctx, func() ([]models.GridInfo, func(int)) {
 		totalCells := int(180.0 / gridSize * 360.0 / gridSize)
 		result := make([]models.GridInfo, 0, totalCells)
 
 		bar := progressbar.Default(int64(totalCells), "Create grid")
 
 		for lat := float32(-90.0); lat <= 90; lat += gridSize {
-			for lng := float32(0.0); lng <= 359.0; lng += gridSize {
+			for lng := float32(0.0); lng < 360; lng += gridSize {
+				if !l.inRegion(lat, lng) {
+					continue
+				}
 				result = append(
 					result,
 					models.GridInfo{
@@ -304,88 +482,285 @@ func main() {
 					})
 			}
 		}
+		bar.ChangeMax(len(result))
 		return result, func(writed int) {
 			bar.Add(writed)
 		}
 	})
+	if err != nil {
+		return errors.Join(ErrInitGrid, err)
+	}
+	return nil
+}
 
+// loadForecastHour download forecast hour of run and write it to storage in one
+// transaction. Return downloaded bytes and written rows
+func (l *loader) loadForecastHour(ctx context.Context, run noaa.Run, forecastTime int) (int64, int64, error) {
+	fields, err := l.processData(ctx, run, forecastTime)
 	if err != nil {
-		panic("failed to init database grid table")
+		return 0, 0, err
 	}
 
-	for i := 0; i < 12; i += 3 {
-		wg.Add(1)
-		go func(f int) {
-			defer wg.Done()
-			records, err := processData(day, month, year, f, cycle, rate)
-			if err != nil {
-				panic(err)
-			}
+	rCount := fields.Land.Len()
+	dbBar := progressbar.Default(int64(rCount), fmt.Sprintf("Write forecast %03d to db", forecastTime))
+	defer dbBar.Close()
 
-			transact, err := storageProvider.Begin(ctx)
+	rows, err := l.storageProvider.CopyRecords(ctx, l.records(run, forecastTime, fields, func(n int) {
+		dbBar.Set(n)
+	}))
 
-			if err != nil {
-				fmt.Println(err)
-				return
-			}
+	return fields.Bytes, rows, err
+}
+
+// records return iterator of records of fields in region: one record per cell
+// on surface and on each isobaric level. progress is called with the number of
+// passed cells
+func (l *loader) records(run noaa.Run, forecastTime int, fields *Fields, progress func(n int)) func() (*models.Record, bool) {
+	rCount := fields.Land.Len()
+	// every cell is written on surface and on each isobaric level
+	lCount := len(fields.Levels) + 1
+
+	// record is reused, CopyRecords does not keep it
+	record := models.Record{
+		RunTime:  run.Time(),
+		DateTime: run.Time().Add(time.Duration(forecastTime) * time.Hour),
+		Values:   make([]float32, len(fields.Values)),
+	}
+	n, k := 0, 0
+	return func() (*models.Record, bool) {
+		for ; n < rCount; n, k = n+1, 0 {
+			if k == 0 {
+				if n%postgres.MAX_BATCH_SIZE == 0 {
+					progress(n)
+				}
 
-			bar := progressbar.Default(int64(len(records)), "Prepare data")
-
-			dbRecords := make([]models.Record, 0, len(records))
-			for _, record := range records {
-				dateTime := time.Date(
-					year,
-					time.Month(month),
-					day,
-					cycleInt+int(record["ftime"]),
-					0,
-					0,
-					0,
-					time.UTC,
-				)
-
-				newRecord := models.Record{
-					DateTime:    dateTime,
-					Lat:         float32(record["lat"]),
-					Lng:         float32(record["lng"]),
-					IsGround:    record["LAND"] != 0,
-					Pressure:    float32(record["PRMSL"]),
-					Temperature: float32(record["TMP"]),
-					UWind:       float32(record["UGRD"]),
-					VWind:       float32(record["VGRD"]),
-					CRain:       float32(record["CRAIN"]),
-					RHUmidity:   float32(record["RH"]),
-					Visibility:  float32(record["VIS"]),
+				record.Lat, record.Lng = fields.Land.Coord(n)
+				if !l.inRegion(record.Lat, record.Lng) {
+					continue
 				}
-				dbRecords = append(dbRecords, newRecord)
-				bar.Add(1)
-				// fmt.Printf("%s : %v\n", key, record)
+				record.IsGround = fields.Land.Data[n] != 0
+			}
+			if k >= lCount {
+				continue
 			}
 
-			bar.Close()
-
-			batchSize := 100
-			rCount := len(records)
-			dbBar := progressbar.Default(int64(rCount/batchSize), "Write to db")
-			for i := 0; i < rCount-1; i += batchSize {
-				err = transact.SetRecords(ctx, dbRecords[i:min(i+batchSize, rCount-1)])
-				dbBar.Add(1)
-				if err != nil {
-					storageProvider.Rollback(ctx)
-					return
+			values := fields.Values
+			record.Level = 0
+			if k > 0 {
+				values = fields.LevelValues[k-1]
+				record.Level = int16(fields.Levels[k-1])
+			}
+			for v, field := range values {
+				if field == nil {
+					record.Values[v] = float32(math.NaN())
+				} else {
+					record.Values[v] = field.Data[n]
 				}
 			}
-			dbBar.Close()
+			k++
+			return &record, true
+		}
+		progress(rCount)
+		return nil, false
+	}
+}
 
-			transact.Commit(ctx)
+// ingestForecastHour load forecast hour and record the attempt in ingest ledger
+func (l *loader) ingestForecastHour(ctx context.Context, run noaa.Run, forecastTime int) error {
+	err := l.storageProvider.StartStep(ctx, run.Time(), forecastTime, l.sourceURLs(run, forecastTime))
+	if err != nil {
+		return err
+	}
 
-		}(i)
+	bytes, rows, err := l.loadForecastHour(ctx, run, forecastTime)
+	if err != nil {
+		// context may be canceled already, ledger must be updated anyway
+		ledgerErr := l.storageProvider.FailStep(context.WithoutCancel(ctx), run.Time(), forecastTime, err)
+		return errors.Join(err, ledgerErr)
 	}
 
-	wg.Wait()
+	return l.storageProvider.FinishStep(ctx, run.Time(), forecastTime, bytes, rows)
+}
+
+// pendingHours return configured forecast hours of run not loaded yet
+func (l *loader) pendingHours(ctx context.Context, run noaa.Run) ([]int, error) {
+	done, err := l.storageProvider.CompletedSteps(ctx, run.Time())
+	if err != nil {
+		return nil, err
+	}
+
+	hours := l.cfg.ForecastHours()
+	pending := make([]int, 0, len(hours))
+	for _, h := range hours {
+		if !slices.Contains(done, h) {
+			pending = append(pending, h)
+		}
+	}
+	return pending, nil
+}
+
+// loadRun load configured forecast hours of run. Loaded hours are skipped,
+// failed hours are retried
+func (l *loader) loadRun(ctx context.Context, run noaa.Run) error {
+	err := l.storageProvider.StartRun(ctx, run.Time())
+	if err != nil {
+		return err
+	}
+
+	pending, err := l.pendingHours(ctx, run)
+	if err != nil {
+		return err
+	}
+	if len(pending) < len(l.cfg.ForecastHours()) {
+		fmt.Printf("Run %s: %d forecast hours already loaded\n", run, len(l.cfg.ForecastHours())-len(pending))
+	}
+
+	// failed hour does not stop the others, errors are collected
+	var (
+		workers  errgroup.Group
+		errsLock sync.Mutex
+		errs     []error
+	)
+	workers.SetLimit(l.cfg.Workers)
+
+	for _, f := range pending {
+		workers.Go(func() error {
+			err := l.ingestForecastHour(ctx, run, f)
+			if err != nil {
+				errsLock.Lock()
+				errs = append(errs, fmt.Errorf("forecast %03d: %w", f, err))
+				errsLock.Unlock()
+			}
+			return nil
+		})
+	}
 
-	storageProvider.Stop()
+	workers.Wait()
 
-	// fmt.Println(records)
+	status := pgModels.IngestStatusComplete
+	if len(errs) > 0 {
+		status = pgModels.IngestStatusFailed
+	}
+	err = l.storageProvider.FinishRun(context.WithoutCancel(ctx), run.Time(), status)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func main() {
+
+	ctx := context.TODO()
+
+	args := os.Args[1:]
+	var command string
+	if len(args) > 0 && (args[0] == "serve" || args[0] == "inventory") {
+		command, args = args[0], args[1:]
+	}
+	serve := command == "serve"
+
+	var inv inventoryFlags
+	register := inv.register
+	if command != "inventory" {
+		register = nil
+	}
+
+	cfg, err := config.LoadWith(os.Args[0], args, register)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if command == "inventory" {
+		if err := runInventory(ctx, cfg, inv, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cat, err := catalog.Load(cfg.Catalog)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if _, ok := cfg.Wave(); !ok {
+		// keep stored wave columns untouched
+		cat = cat.WithoutModel(catalog.ModelWave)
+	}
+	if len(cfg.IsobaricLevels()) == 0 {
+		cat = cat.Filter(func(v catalog.Variable) bool { return !v.Isobaric() })
+	}
+
+	var reg *region.Region
+	if cfg.Region != "" {
+		reg, err = region.Parse(cfg.Region)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	if err := load(ctx, cfg, cat, reg, serve); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// load connect storage and init grid table, then load configured (or latest)
+// run or follow runs in serve mode
+func load(ctx context.Context, cfg *config.Config, cat *catalog.Catalog, reg *region.Region, serve bool) error {
+	storageProvider := postgres.New(cfg.DSN, cat)
+	if err := storageProvider.Run(); err != nil {
+		return err
+	}
+	defer storageProvider.Stop()
+
+	l := newLoader(cfg, cat, reg, storageProvider)
+
+	if err := l.initGrid(ctx); err != nil {
+		return err
+	}
+
+	if serve {
+		return l.runDaemon(ctx)
+	}
+
+	run, ok := cfg.Run()
+	if !ok {
+		var err error
+		run, err = l.latestRun(ctx)
+		if err != nil {
+			return errors.Join(ErrLatestRun, err)
+		}
+		fmt.Printf("Latest complete run: %s\n", run)
+	}
+
+	if err := l.loadRun(ctx, run); err != nil {
+		return fmt.Errorf("run %s: %w", run, err)
+	}
+
+	l.pruneRuns(ctx, run)
+	return nil
+}
+
+// pruneRuns apply runs retention keeping the loaded run
+func (l *loader) pruneRuns(ctx context.Context, loaded noaa.Run) {
+	deleted, err := l.storageProvider.PruneRuns(ctx, l.cfg.KeepRuns, loaded.Time())
+	if err != nil {
+		fmt.Printf("Prune runs: %s\n", err)
+		return
+	}
+	if deleted > 0 {
+		fmt.Printf("Pruned %d records of old runs\n", deleted)
+	}
+}
 
+// latestRun return the newest run with every configured forecast hour published
+func (l *loader) latestRun(ctx context.Context) (noaa.Run, error) {
+	return source.Latest(ctx, l.source, l.cfg.ForecastHours(), time.Now(), l.cfg.Lookback)
 }
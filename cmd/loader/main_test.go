@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gfsloader/internal/grid"
+	"gfsloader/internal/models"
+	"gfsloader/utils/noaa"
+
+	"github.com/nilsmagnus/grib/griblib"
+)
+
+// benchFields land mask and 8 variables of 0.5° grid
+func benchFields(b *testing.B) *Fields {
+	def := &griblib.Grid0{Ni: 720, Nj: 361, La1: 90000000, Di: 500000, Dj: 500000}
+	field := func(seed int) *grid.Field {
+		data := make([]float64, def.Ni*def.Nj)
+		for n := range data {
+			data[n] = float64((n + seed) % 7)
+		}
+		f, err := grid.NewFieldGrid0(def, data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return f
+	}
+
+	fields := &Fields{Land: field(0)}
+	for v := 0; v < 8; v++ {
+		fields.Values = append(fields.Values, field(v+1))
+	}
+	return fields
+}
+
+// mapRecords records of fields built the former way: values of every point are
+// put into a map keyed by formatted coordinates, then copied into records
+func mapRecords(fields *Fields, run noaa.Run, forecastTime int) []models.Record {
+	var recordsLock sync.Mutex
+	records := make(map[string]map[string]float64)
+	putRecord := func(lat, lng float32, tag string, value float64) {
+		defer recordsLock.Unlock()
+		recordsLock.Lock()
+
+		key := fmt.Sprintf("%+07d%07d%d", int(lat*100), int(lng*100), forecastTime)
+		if r, ok := records[key]; ok {
+			r[tag] = value
+		} else {
+			newR := make(map[string]float64, len(fields.Values)+3)
+			newR["lat"] = float64(lat)
+			newR["lng"] = float64(lng)
+			newR[tag] = value
+			records[key] = newR
+		}
+	}
+
+	names := make([]string, len(fields.Values))
+	layers := append([]*grid.Field{fields.Land}, fields.Values...)
+	for v, field := range layers {
+		name := landMask.name
+		if v > 0 {
+			names[v-1] = fmt.Sprintf("var%d", v)
+			name = names[v-1]
+		}
+		for n, value := range field.Data {
+			lat, lng := field.Coord(n)
+			putRecord(lat, lng, name, float64(value))
+		}
+	}
+
+	dbRecords := make([]models.Record, 0, len(records))
+	for _, record := range records {
+		newRecord := models.Record{
+			RunTime:  run.Time(),
+			DateTime: run.Time().Add(time.Duration(forecastTime) * time.Hour),
+			Lat:      float32(record["lat"]),
+			Lng:      float32(record["lng"]),
+			IsGround: record[landMask.name] != 0,
+			Values:   make([]float32, len(names)),
+		}
+		for v, name := range names {
+			newRecord.Values[v] = float32(record[name])
+		}
+		dbRecords = append(dbRecords, newRecord)
+	}
+	return dbRecords
+}
+
+// BenchmarkRecords compare records streamed from dense fields with records
+// built through maps of values
+func BenchmarkRecords(b *testing.B) {
+	fields := benchFields(b)
+	run := noaa.NewRun(time.Date(2024, 1, 2, 6, 0, 0, 0, time.UTC))
+	l := &loader{}
+
+	b.Run("dense", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			next := l.records(run, 6, fields, func(int) {})
+			count := 0
+			for _, ok := next(); ok; _, ok = next() {
+				count++
+			}
+			if count != fields.Land.Len() {
+				b.Fatalf("%d records, want %d", count, fields.Land.Len())
+			}
+		}
+	})
+
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if records := mapRecords(fields, run, 6); len(records) == 0 {
+				b.Fatal("no records")
+			}
+		}
+	})
+}
+
+func TestCachedSize(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "gfs_6.idx.size")
+	calls := 0
+	size := func() (uint64, error) {
+		calls++
+		return 1234, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if n, err := cachedSize(name, size); err != nil || n != 1234 {
+			t.Fatalf("cachedSize = %d, %v, want 1234", n, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("size got %d times, want once", calls)
+	}
+
+	errSize := errors.New("head failed")
+	if _, err := cachedSize(name+"2", func() (uint64, error) { return 0, errSize }); !errors.Is(err, errSize) {
+		t.Errorf("error %v, want %v", err, errSize)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"gfsloader/internal/source"
+	"gfsloader/utils/download"
+	"gfsloader/utils/indexfile"
+	"gfsloader/utils/noaa"
+)
+
+// fetchLayers download messages of layers missing in cache to layerFiles.
+// Messages separated by not more than range gap bytes are fetched by one
+// request and split back into layer files
+func (l *loader) fetchLayers(ctx context.Context, src source.Source, run noaa.Run, forecastTime int, gribBaseFileName string, idx *indexfile.IndexFile, layers []message, layerFiles []string) error {
+	var (
+		ranges []download.Range
+		files  []string
+		labels []string
+	)
+	seen := make(map[string]struct{}, len(layers))
+	for n, layer := range layers {
+		if _, ok := seen[layerFiles[n]]; ok {
+			continue
+		}
+		seen[layerFiles[n]] = struct{}{}
+
+		if _, err := os.Stat(layerFiles[n]); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		from, to, err := idx.GetOffset(layer.param, layer.layer)
+		if err != nil {
+			return errors.Join(ErrProcess, fmt.Errorf("\"%s-%s\": %w", layer.param, layer.layer, err))
+		}
+		ranges = append(ranges, download.Range{From: from, To: to})
+		files = append(files, layerFiles[n])
+		labels = append(labels, fmt.Sprintf("%s:%s", layer.param, layer.layer))
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errsLock sync.Mutex
+		errs     []error
+	)
+	for _, span := range download.Plan(ranges, uint64(l.cfg.RangeGap)) {
+		wg.Add(1)
+		go func(span download.Span) {
+			defer wg.Done()
+
+			label := "Get " + labels[span.Parts[0]]
+			if len(span.Parts) > 1 {
+				label += fmt.Sprintf(" +%d", len(span.Parts)-1)
+			}
+
+			err := fetchSpan(ctx, src, label, run, forecastTime, span, ranges, files,
+				fmt.Sprintf("%s_%d-%d", gribBaseFileName, span.From, span.To))
+			if err != nil {
+				errsLock.Lock()
+				errs = append(errs, err)
+				errsLock.Unlock()
+			}
+		}(span)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errors.Join(append([]error{ErrProcess}, errs...)...)
+	}
+	return nil
+}
+
+// fetchSpan download span and save its ranges to files. Single range is
+// saved directly, merged ranges are split from spanFile
+func fetchSpan(ctx context.Context, src source.Source, label string, run noaa.Run, forecastTime int, span download.Span, ranges []download.Range, files []string, spanFile string) error {
+	if len(span.Parts) == 1 {
+		return src.FetchRange(ctx, label, run, forecastTime, span.From, span.To, files[span.Parts[0]])
+	}
+
+	err := src.FetchRange(ctx, label, run, forecastTime, span.From, span.To, spanFile)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spanFile)
+
+	in, err := os.Open(spanFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	for _, n := range span.Parts {
+		offset, length := span.Part(ranges[n])
+		if err := splitPart(in, int64(offset), int64(length), files[n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitPart save length bytes (0 up to the end) of in from offset to dest
+func splitPart(in *os.File, offset, length int64, dest string) error {
+	var r io.Reader = io.NewSectionReader(in, offset, 1<<62)
+	if length > 0 {
+		r = io.NewSectionReader(in, offset, length)
+	}
+
+	tmp := dest + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(out, r)
+	if err = errors.Join(err, out.Close()); err == nil && length > 0 && n != length {
+		err = fmt.Errorf("%s: got %d bytes of span, expected %d", dest, n, length)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, dest)
+}
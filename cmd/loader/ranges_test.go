@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gfsloader/internal/source"
+	"gfsloader/utils/download"
+	"gfsloader/utils/noaa"
+)
+
+func TestFetchSpan(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+	src := source.NewLocal(t.TempDir(), noaa.GridSize0p25)
+	run := noaa.Run{Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Cycle: noaa.ModelCycle06}
+	location := src.Location(run, 6)
+	if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(location, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		ranges []download.Range
+		gap    uint64
+		want   []string
+	}{
+		{"single range", []download.Range{{From: 10, To: 15}}, 0, []string{"abcdef"}},
+		{"merged ranges", []download.Range{{From: 20, To: 0}, {From: 0, To: 3}, {From: 6, To: 9}}, 10, []string{"klmnopqrstuvwxyz", "0123", "6789"}},
+		{"repeated range", []download.Range{{From: 2, To: 4}, {From: 2, To: 4}}, 0, []string{"234", "234"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := make([]string, len(tt.ranges))
+			for n := range files {
+				files[n] = filepath.Join(dir, string(rune('a'+n)))
+			}
+
+			spans := download.Plan(tt.ranges, tt.gap)
+			if len(spans) != 1 {
+				t.Fatalf("%d spans, want 1", len(spans))
+			}
+			spanFile := filepath.Join(dir, "span")
+			if err := fetchSpan(context.Background(), src, "", run, 6, spans[0], tt.ranges, files, spanFile); err != nil {
+				t.Fatal(err)
+			}
+
+			for n, name := range files {
+				if b, err := os.ReadFile(name); err != nil || string(b) != tt.want[n] {
+					t.Errorf("range %d: got %q, %v, want %q", n, b, err, tt.want[n])
+				}
+			}
+			if _, err := os.Stat(spanFile); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("span file is left: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"gfsloader/cmd/loader/config"
+	"gfsloader/internal/storage"
+	pgModels "gfsloader/internal/storage/postgres/models"
+	"gfsloader/utils/noaa"
+)
+
+const (
+	stopTimeout = 30 * time.Second
+)
+
+// runDaemon follow GFS runs until SIGTERM or SIGINT
+func (l *loader) runDaemon(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errSig := make(chan error, 1)
+	stopSig := make(chan os.Signal, 1)
+
+	go func() {
+		errSig <- l.follow(ctx)
+	}()
+
+	signal.Notify(stopSig, syscall.SIGTERM, syscall.SIGINT)
+
+	select {
+	case err := <-errSig:
+		return err
+	case <-stopSig:
+		cancel()
+		select {
+		case <-errSig:
+		case <-time.After(stopTimeout):
+			fmt.Println("Loader stop timeout")
+		}
+		fmt.Println("Loader stopped")
+	}
+	return nil
+}
+
+// startRun return the run to follow: the newest run of ingest ledger, the
+// configured run or the latest published run
+func (l *loader) startRun(ctx context.Context) (noaa.Run, error) {
+	latest, err := l.storageProvider.LatestRun(ctx)
+	if err == nil {
+		run := noaa.NewRun(latest.RunTime)
+		if latest.Status == pgModels.IngestStatusComplete {
+			run = run.Next()
+		}
+		return run, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return noaa.Run{}, err
+	}
+
+	run, ok := l.cfg.Run()
+	if ok {
+		return run, nil
+	}
+
+	run, err = l.latestRun(ctx)
+	if errors.Is(err, noaa.ErrRunNotFound) {
+		return noaa.NewRun(time.Now()), nil
+	}
+	return run, err
+}
+
+// follow load every forecast hour of the current run as soon as its index file
+// is published, then move to the next run. Progress is kept in ingest ledger
+func (l *loader) follow(ctx context.Context) error {
+	cfg := l.cfg
+	pollInterval := time.Duration(cfg.PollInterval)
+	maxDelay := time.Duration(cfg.Lookback) * 6 * time.Hour
+
+	run, err := l.startRun(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Start from run %s\n", run)
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// NOMADS keeps a few days only; jump forward when we are too far behind
+		if time.Since(run.Time()) > maxDelay {
+			latest, err := l.latestRun(ctx)
+			if err == nil && latest.Time().After(run.Time()) {
+				fmt.Printf("Run %s is outdated, skip to %s\n", run, latest)
+				run = latest
+				continue
+			}
+		}
+
+		if wait := time.Until(run.Time()); wait > 0 {
+			if err := sleep(ctx, wait); err != nil {
+				return nil
+			}
+			continue
+		}
+
+		err := l.storageProvider.StartRun(ctx, run.Time())
+		if err != nil {
+			return err
+		}
+
+		pending, err := l.pendingHours(ctx, run)
+		if err != nil {
+			return err
+		}
+
+		for _, hour := range pending {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			ok, err := l.source.HasIndex(ctx, run, hour)
+			if err != nil {
+				fmt.Printf("Run %s forecast %03d: %s\n", run, hour, err)
+				break
+			}
+			if !ok {
+				// hours are published in order
+				break
+			}
+
+			err = l.ingestForecastHour(ctx, run, hour)
+			if err != nil {
+				fmt.Printf("Run %s forecast %03d: %s\n", run, hour, err)
+				break
+			}
+			pending = pending[1:]
+		}
+
+		if len(pending) == 0 {
+			err := l.storageProvider.FinishRun(ctx, run.Time(), pgModels.IngestStatusComplete)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Run %s loaded\n", run)
+			removeRunCache(cfg, run)
+			l.pruneRuns(ctx, run)
+			run = run.Next()
+			continue
+		}
+
+		if err := sleep(ctx, pollInterval); err != nil {
+			return nil
+		}
+	}
+}
+
+// removeRunCache remove downloaded files of the loaded run
+func removeRunCache(cfg *config.Config, run noaa.Run) {
+	files, err := filepath.Glob(filepath.Join(cfg.CacheDir, runCacheName(cfg, run)+"_*"))
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		os.Remove(f)
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
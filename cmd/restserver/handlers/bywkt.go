@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	httpModels "gfsloader/cmd/restserver/models"
+	"gfsloader/internal/catalog"
 	appModels "gfsloader/internal/models"
 	"gfsloader/internal/storage/postgres/models"
 	"net/http"
@@ -13,18 +15,22 @@ import (
 )
 
 type ForecastProvider interface {
-	GetForecastBySegments(ctx context.Context, segments []appModels.WKTRequestItem) ([]models.PGResponse, error)
+	GetForecastBySegments(ctx context.Context, segments []appModels.WKTRequestItem, variables []catalog.Variable, run *time.Time, levels appModels.LevelFilter) ([]models.PGResponse, error)
+	GetForecastByPoints(ctx context.Context, points []appModels.WKTRequestItem, variables []catalog.Variable, run *time.Time, levels appModels.LevelFilter) ([]models.PGResponse, error)
 }
 
 type WKTHandler struct {
 	forecastProvider ForecastProvider
+	catalog          *catalog.Catalog
 }
 
 func NewWKTHandler(
 	forecastProvider ForecastProvider,
+	cat *catalog.Catalog,
 ) *WKTHandler {
 	return &WKTHandler{
 		forecastProvider: forecastProvider,
+		catalog:          cat,
 	}
 }
 
@@ -40,9 +46,84 @@ func (h *WKTHandler) HandlerByWKT(c *gin.Context) {
 		return
 	}
 
+	variables, err := h.catalog.Select(body.Components)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	levels := appModels.LevelFilter{Column: body.Column}
+	if body.Level != nil {
+		if *body.Level <= 0 {
+			c.IndentedJSON(http.StatusBadRequest, "level must be positive (hPa)")
+			return
+		}
+		levels.Level = *body.Level
+	}
+
+	variables = levelVariables(variables, levels)
+	if len(variables) == 0 {
+		c.IndentedJSON(http.StatusBadRequest, "no components on requested level")
+		return
+	}
+
+	var interval time.Duration
+	if body.Interval != "" {
+		interval, err = time.ParseDuration(body.Interval)
+		if err != nil || interval < minInterval || interval > maxInterval {
+			c.IndentedJSON(http.StatusBadRequest, fmt.Sprintf("interval must be %s..%s", minInterval, maxInterval))
+			return
+		}
+	}
+
+	method := body.Point
+	if method == "" {
+		method = PointBilinear
+	}
+	if method != PointBilinear && method != PointNearest && method != PointCell {
+		c.IndentedJSON(http.StatusBadRequest, fmt.Sprintf("point must be %s, %s or %s", PointBilinear, PointNearest, PointCell))
+		return
+	}
+
+	// shapes and points are queried separately, qIdx and pointIdx map their
+	// indexes to requested shapes
 	q := make([]appModels.WKTRequestItem, 0, len(body.Shapes))
+	var (
+		qIdx, pointIdx []int
+		pointQ         []appModels.WKTRequestItem
+		pointShapes    []string
+	)
+	// requested is q before rounding or widening to stored steps
+	requested := make([]appModels.WKTRequestItem, 0, len(body.Shapes))
 
-	for _, item := range body.Shapes {
+	for i, item := range body.Shapes {
+		if method != PointCell && isPoint(item.WKT) {
+			pointIdx = append(pointIdx, i)
+			pointShapes = append(pointShapes, item.WKT)
+		} else {
+			qIdx = append(qIdx, i)
+		}
+
+		requested = append(requested, appModels.WKTRequestItem{
+			WKT:  item.WKT,
+			From: item.From,
+			To:   item.To,
+		})
+
+		if interval > 0 {
+			to := item.From
+			if item.To != nil {
+				to = *item.To
+			}
+			to = to.Add(interpolationMargin)
+
+			q = append(q, appModels.WKTRequestItem{
+				WKT:  item.WKT,
+				From: item.From.Add(-interpolationMargin),
+				To:   &to,
+			})
+			continue
+		}
 
 		to := item.To
 		if to != nil {
@@ -58,20 +139,61 @@ func (h *WKTHandler) HandlerByWKT(c *gin.Context) {
 		})
 	}
 
-	res, err := h.forecastProvider.GetForecastBySegments(c.Request.Context(), q)
+	// split query items by the shape kind
+	for _, i := range pointIdx {
+		pointQ = append(pointQ, q[i])
+	}
+	for n, i := range qIdx {
+		q[n] = q[i]
+	}
+	q = q[:len(qIdx)]
 
-	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, "Some error")
-		return
+	var res []models.PGResponse
+	if len(q) > 0 {
+		res, err = h.forecastProvider.GetForecastBySegments(c.Request.Context(), q, variables, body.Run, levels)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, "Some error")
+			return
+		}
+		for n := range res {
+			res[n].Segment = qIdx[res[n].Segment]
+		}
+	}
+
+	if len(pointQ) > 0 {
+		nodes, err := h.forecastProvider.GetForecastByPoints(c.Request.Context(), pointQ, variables, body.Run, levels)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, "Some error")
+			return
+		}
+		for _, item := range pointValues(nodes, variables, pointShapes, method) {
+			item.Segment = pointIdx[item.Segment]
+			res = append(res, item)
+		}
+	}
+
+	var points []forecastPoint
+	if interval > 0 {
+		points = interpolate(res, variables, requested, interval)
+	} else {
+		points = make([]forecastPoint, 0, len(res))
+		for _, item := range res {
+			points = append(points, forecastPoint{PGResponse: item})
+		}
+	}
+
+	units := make(map[string]string, len(variables))
+	for _, v := range variables {
+		units[v.Output] = v.Units
 	}
 
-	response := make([]httpModels.ForecastResponse, 0, len(res))
-	shapeGroup := make(map[string][]models.PGResponse, len(res))
-	for _, item := range res {
+	response := make([]httpModels.ForecastResponse, 0, len(points))
+	shapeGroup := make(map[string][]forecastPoint, len(points))
+	for _, item := range points {
 		if l, ok := shapeGroup[item.Sec]; ok {
 			shapeGroup[item.Sec] = append(l, item)
 		} else {
-			shapeGroup[item.Sec] = []models.PGResponse{
+			shapeGroup[item.Sec] = []forecastPoint{
 				item,
 			}
 		}
@@ -81,21 +203,19 @@ func (h *WKTHandler) HandlerByWKT(c *gin.Context) {
 
 		fcst := httpModels.ForecastResponse{
 			Shape:    shape,
+			Units:    units,
 			Forecast: make([]httpModels.ForecastDetail, 0, len(items)),
 		}
 
 		for _, item := range items {
 			fcst.Forecast = append(fcst.Forecast,
 				httpModels.ForecastDetail{
-					DateTime:    item.Date,
-					Temperature: &item.Temperature,
-					Pressure:    &item.Pressure,
-					RHumidity:   &item.RHumidity,
-					CRain:       &item.CRain,
-					Wind: &httpModels.WindInfo{
-						U: item.UWind,
-						V: item.VWind,
-					},
+					DateTime:     item.Date,
+					Run:          item.Run,
+					LeadTime:     item.Lead,
+					Level:        item.Level,
+					Interpolated: item.Interpolated,
+					Values:       outputValues(variables, item.Values),
 				})
 		}
 
@@ -104,3 +224,41 @@ func (h *WKTHandler) HandlerByWKT(c *gin.Context) {
 
 	c.IndentedJSON(http.StatusOK, response)
 }
+
+// levelVariables keep isobaric variables for level and column requests,
+// surface variables otherwise
+func levelVariables(variables []catalog.Variable, levels appModels.LevelFilter) []catalog.Variable {
+	isobaric := levels.Column || levels.Level > 0
+	result := make([]catalog.Variable, 0, len(variables))
+	for _, v := range variables {
+		if v.Isobaric() == isobaric {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// outputValues arrange values by catalog output paths
+func outputValues(variables []catalog.Variable, values map[string]float64) map[string]interface{} {
+	result := make(map[string]interface{}, len(variables))
+	for _, v := range variables {
+		value, ok := values[v.Name]
+		if !ok {
+			continue
+		}
+
+		object, field := v.OutputPath()
+		if object == "" {
+			result[field] = value
+			continue
+		}
+
+		nested, ok := result[object].(map[string]float64)
+		if !ok {
+			nested = make(map[string]float64, 2)
+			result[object] = nested
+		}
+		nested[field] = value
+	}
+	return result
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"gfsloader/internal/catalog"
+	appModels "gfsloader/internal/models"
+	"gfsloader/internal/storage/postgres/models"
+)
+
+const (
+	// interpolationMargin stored steps queried around requested time range, not
+	// less than the longest GFS forecast step
+	interpolationMargin = 12 * time.Hour
+
+	minInterval = time.Minute
+	maxInterval = 24 * time.Hour
+)
+
+// forecastPoint forecast values at date-time. Interpolated is false for stored model output
+type forecastPoint struct {
+	models.PGResponse
+	Interpolated bool
+}
+
+// cellKey cell of requested segment
+type cellKey struct {
+	segment int
+	sec     string
+}
+
+// interpolate return points every interval within time ranges of segments.
+// Stored steps are sorted by date-time, as returned by storage
+func interpolate(res []models.PGResponse, variables []catalog.Variable, segments []appModels.WKTRequestItem, interval time.Duration) []forecastPoint {
+	var cells []cellKey
+	// series stored steps of cell by level
+	series := make(map[cellKey]map[int][]models.PGResponse)
+	for _, item := range res {
+		key := cellKey{item.Segment, item.Sec}
+		levels, ok := series[key]
+		if !ok {
+			cells = append(cells, key)
+			levels = make(map[int][]models.PGResponse, 1)
+			series[key] = levels
+		}
+		levels[item.Level] = append(levels[item.Level], item)
+	}
+
+	result := make([]forecastPoint, 0, len(res))
+	for _, cell := range cells {
+		if cell.segment < 0 || cell.segment >= len(segments) {
+			continue
+		}
+
+		// column levels from the ground up, as stored steps
+		levels := make([]int, 0, len(series[cell]))
+		for level := range series[cell] {
+			levels = append(levels, level)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(levels)))
+
+		from := segments[cell.segment].From
+		to := from
+		if segments[cell.segment].To != nil {
+			to = *segments[cell.segment].To
+		}
+
+		t := from.Truncate(interval)
+		if t.Before(from) {
+			t = t.Add(interval)
+		}
+		for ; !t.After(to); t = t.Add(interval) {
+			for _, level := range levels {
+				if point, ok := interpolateAt(series[cell][level], variables, t, interval); ok {
+					result = append(result, point)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// interpolateAt return point at t between stored steps. ok is false when t is
+// outside of steps
+func interpolateAt(steps []models.PGResponse, variables []catalog.Variable, t time.Time, interval time.Duration) (forecastPoint, bool) {
+	// first step after t
+	k := sort.Search(len(steps), func(i int) bool { return steps[i].Date.After(t) })
+	if k == 0 {
+		return forecastPoint{}, false
+	}
+
+	a := steps[k-1]
+	exact := a.Date.Equal(t)
+	if !exact && k == len(steps) {
+		return forecastPoint{}, false
+	}
+
+	point := forecastPoint{
+		PGResponse: models.PGResponse{
+			Segment: a.Segment,
+			Sec:     a.Sec,
+			Date:    t,
+			Run:     a.Run,
+			Lead:    int(t.Sub(a.Run) / time.Hour),
+			Level:   a.Level,
+			Values:  make(map[string]float64, len(variables)),
+		},
+		Interpolated: !exact,
+	}
+
+	for _, v := range variables {
+		if v.Accumulated() {
+			if value, ok := spread(steps, v, t, interval); ok {
+				point.Values[v.Name] = value
+			}
+			continue
+		}
+
+		va, ok := a.Values[v.Name]
+		if !ok {
+			continue
+		}
+		if exact {
+			point.Values[v.Name] = va
+			continue
+		}
+
+		b := steps[k]
+		vb, ok := b.Values[v.Name]
+		if !ok {
+			continue
+		}
+
+		w := float64(t.Sub(a.Date)) / float64(b.Date.Sub(a.Date))
+		switch v.Interpolation {
+		case catalog.InterpolationCircular:
+			d := math.Mod(vb-va+540, 360) - 180
+			point.Values[v.Name] = math.Mod(va+w*d+360, 360)
+		default:
+			point.Values[v.Name] = va + w*(vb-va)
+		}
+	}
+
+	return point, true
+}
+
+// spread return accumulated variable over (t-interval, t]. Every stored value
+// covers the time from the previous step with constant rate. ok is false when
+// steps do not cover the whole interval
+func spread(steps []models.PGResponse, v catalog.Variable, t time.Time, interval time.Duration) (float64, bool) {
+	start := t.Add(-interval)
+
+	var (
+		total   float64
+		covered time.Duration
+	)
+	for k := 1; k < len(steps); k++ {
+		from, to := steps[k-1].Date, steps[k].Date
+		if !to.After(start) || !from.Before(t) {
+			continue
+		}
+
+		value, ok := steps[k].Values[v.Name]
+		if !ok {
+			return 0, false
+		}
+
+		rate := value
+		if v.Accumulation == catalog.AccumulationAmount {
+			rate /= to.Sub(from).Hours()
+		}
+
+		overlap := minTime(to, t).Sub(maxTime(from, start))
+		total += rate * overlap.Hours()
+		covered += overlap
+	}
+
+	if covered != interval {
+		return 0, false
+	}
+
+	if v.Accumulation == catalog.AccumulationRate {
+		return total / interval.Hours(), true
+	}
+	return total, true
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gfsloader/internal/catalog"
+	"gfsloader/internal/storage/postgres/models"
+)
+
+// Point interpolation methods of POINT shapes
+const (
+	// PointBilinear weight grid nodes around the point of the same land/sea class
+	PointBilinear = "bilinear"
+	// PointNearest take the nearest grid node
+	PointNearest = "nearest"
+	// PointCell return every grid cell containing the point, as other shapes
+	PointCell = "cell"
+)
+
+var pointRe = regexp.MustCompile(`(?i)^\s*POINT\s*\(\s*(\S+)\s+(\S+)\s*\)\s*$`)
+
+// isPoint check WKT is POINT
+func isPoint(wkt string) bool {
+	m := pointRe.FindStringSubmatch(wkt)
+	if m == nil {
+		return false
+	}
+	_, errLng := strconv.ParseFloat(m[1], 64)
+	_, errLat := strconv.ParseFloat(m[2], 64)
+	return errLng == nil && errLat == nil
+}
+
+// nodeKey grid nodes of requested point at date-time on level
+type nodeKey struct {
+	segment int
+	date    time.Time
+	level   int
+}
+
+// pointValues interpolate values of grid nodes around points to the points.
+// shapes are WKT of requested points by segment index
+func pointValues(res []models.PGResponse, variables []catalog.Variable, shapes []string, method string) []models.PGResponse {
+	var keys []nodeKey
+	nodes := make(map[nodeKey][]models.PGResponse)
+	for _, item := range res {
+		key := nodeKey{item.Segment, item.Date, item.Level}
+		if _, ok := nodes[key]; !ok {
+			keys = append(keys, key)
+		}
+		nodes[key] = append(nodes[key], item)
+	}
+
+	result := make([]models.PGResponse, 0, len(keys))
+	for _, key := range keys {
+		near := nodes[key]
+
+		nearest := near[0]
+		for _, node := range near[1:] {
+			if math.Hypot(node.DX, node.DY) < math.Hypot(nearest.DX, nearest.DY) {
+				nearest = node
+			}
+		}
+
+		point := nearest
+		point.Sec = shapes[key.segment]
+		point.DX, point.DY = 0, 0
+		if method == PointBilinear {
+			point.Values = bilinear(near, variables, nearest.IsGround)
+		}
+		result = append(result, point)
+	}
+
+	return result
+}
+
+// bilinear interpolate values of nodes closer than one grid step. Nodes of
+// land/sea class other than ground are skipped for atmosphere variables, wave
+// variables exist over sea only. Weights are normalized over nodes with values
+func bilinear(nodes []models.PGResponse, variables []catalog.Variable, ground bool) map[string]float64 {
+	values := make(map[string]float64, len(variables))
+	for _, v := range variables {
+		var sum, sumX, sumY, weights float64
+		for _, node := range nodes {
+			if v.Model == catalog.ModelAtmos && node.IsGround != ground {
+				continue
+			}
+			value, ok := node.Values[v.Name]
+			if !ok || node.Step <= 0 {
+				continue
+			}
+
+			w := (1 - math.Abs(node.DX)/node.Step) * (1 - math.Abs(node.DY)/node.Step)
+			if w <= 0 {
+				continue
+			}
+
+			if v.Interpolation == catalog.InterpolationCircular {
+				rad := value * math.Pi / 180
+				sumX += w * math.Sin(rad)
+				sumY += w * math.Cos(rad)
+			} else {
+				sum += w * value
+			}
+			weights += w
+		}
+
+		if weights == 0 {
+			continue
+		}
+		if v.Interpolation == catalog.InterpolationCircular {
+			values[v.Name] = math.Mod(math.Atan2(sumX, sumY)*180/math.Pi+360, 360)
+		} else {
+			values[v.Name] = sum / weights
+		}
+	}
+	return values
+}
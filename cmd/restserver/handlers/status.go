@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	httpModels "gfsloader/cmd/restserver/models"
+	"gfsloader/internal/storage/postgres/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	statusRunsLimit = 10
+)
+
+type IngestProvider interface {
+	IngestSummary(ctx context.Context, limit int) ([]models.PGIngestSummary, error)
+}
+
+type StatusHandler struct {
+	ingestProvider IngestProvider
+}
+
+func NewStatusHandler(
+	ingestProvider IngestProvider,
+) *StatusHandler {
+	return &StatusHandler{
+		ingestProvider: ingestProvider,
+	}
+}
+
+// HandlerStatus report data freshness from ingest ledger
+func (h *StatusHandler) HandlerStatus(c *gin.Context) {
+	runs, err := h.ingestProvider.IngestSummary(c.Request.Context(), statusRunsLimit)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, "Some error")
+		return
+	}
+
+	response := httpModels.StatusResponse{
+		Runs: make([]httpModels.IngestRun, 0, len(runs)),
+	}
+
+	for _, run := range runs {
+		item := httpModels.IngestRun{
+			Run:           run.RunTime,
+			Status:        run.Status,
+			StartedAt:     run.StartedAt,
+			FinishedAt:    run.FinishedAt,
+			StepsComplete: run.StepsComplete,
+			StepsFailed:   run.StepsFailed,
+			Rows:          run.Rows,
+		}
+		response.Runs = append(response.Runs, item)
+
+		if response.Latest == nil && run.Status == models.IngestStatusComplete {
+			response.Latest = &item
+			response.Age = int64(time.Since(run.RunTime).Seconds())
+		}
+	}
+
+	c.IndentedJSON(http.StatusOK, response)
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"gfsloader/cmd/restserver/handlers"
 	"gfsloader/cmd/restserver/serverapp"
+	"gfsloader/internal/catalog"
 	"gfsloader/internal/storage/postgres"
 	"os"
 	"os/signal"
@@ -20,12 +22,22 @@ func main() {
 
 	ctx := context.TODO()
 
-	storageProvider := postgres.New("host=localhost port=5555 user=postgres dbname=weather password=postgres sslmode=disable")
+	catalogPath := flag.String("catalog", "", "variable catalog file (built-in catalog if empty)")
+	flag.Parse()
+
+	cat, err := catalog.Load(*catalogPath)
+	if err != nil {
+		panic(err)
+	}
+
+	storageProvider := postgres.New("host=localhost port=5555 user=postgres dbname=weather password=postgres sslmode=disable", cat)
 	storageProvider.MustRun()
 
-	wktHandler := handlers.NewWKTHandler(storageProvider)
+	wktHandler := handlers.NewWKTHandler(storageProvider, cat)
+
+	statusHandler := handlers.NewStatusHandler(storageProvider)
 
-	serverApp := serverapp.New(apiBasePath, wktHandler)
+	serverApp := serverapp.New(apiBasePath, wktHandler, statusHandler)
 
 	errSig := make(chan error)
 	stopSig := make(chan os.Signal, 1)
@@ -3,8 +3,18 @@ package models
 import "time"
 
 type WKTRequestBody struct {
-	Components []string     `json:"components,omitempty"`
-	Shapes     []WKTRequest `json:"shapes"`
+	Components []string `json:"components,omitempty"`
+	// Run model run reference time. Newest complete run if empty
+	Run *time.Time `json:"run,omitempty"`
+	// Level isobaric level (hPa) of pressure-level components. Surface if empty
+	Level *int `json:"level,omitempty"`
+	// Column every isobaric level of pressure-level components
+	Column bool `json:"column,omitempty"`
+	// Point interpolation of POINT shapes: bilinear (default), nearest or cell
+	Point string `json:"point,omitempty"`
+	// Interval output interval ("1h", "30m"). Stored forecast steps if empty
+	Interval string       `json:"interval,omitempty"`
+	Shapes   []WKTRequest `json:"shapes"`
 }
 
 type WKTRequest struct {
@@ -1,22 +1,42 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
-type WindInfo struct {
-	U float64 `json:"u"`
-	V float64 `json:"v"`
+// ForecastDetail forecast values at date-time. Values hold numbers or nested
+// objects of numbers (e.g. "wind-10m": {"u": 1, "v": 2}) keyed by catalog output
+type ForecastDetail struct {
+	DateTime time.Time
+	// Run model run reference time
+	Run time.Time
+	// LeadTime hours from Run to DateTime
+	LeadTime int
+	// Level isobaric level (hPa), 0 for surface
+	Level int
+	// Interpolated values are interpolated between stored forecast steps
+	Interpolated bool
+	Values       map[string]interface{}
 }
 
-type ForecastDetail struct {
-	DateTime    time.Time `json:"date-time"`
-	Temperature *float64  `json:"temperature-2m,omitempty"`
-	Pressure    *float64  `json:"pressure-surface,omitempty"`
-	RHumidity   *float64  `json:"rhumidity-surface,omitempty"`
-	CRain       *float64  `json:"crain-surface,omitempty"`
-	Wind        *WindInfo `json:"wind-10m,omitempty"`
+func (d ForecastDetail) MarshalJSON() ([]byte, error) {
+	res := make(map[string]interface{}, len(d.Values)+5)
+	for k, v := range d.Values {
+		res[k] = v
+	}
+	res["date-time"] = d.DateTime
+	res["run"] = d.Run
+	res["lead-time"] = d.LeadTime
+	res["interpolated"] = d.Interpolated
+	if d.Level > 0 {
+		res["level"] = d.Level
+	}
+	return json.Marshal(res)
 }
 
 type ForecastResponse struct {
-	Shape    string           `json:"shape"`
-	Forecast []ForecastDetail `json:"forecast"`
+	Shape    string            `json:"shape"`
+	Units    map[string]string `json:"units,omitempty"`
+	Forecast []ForecastDetail  `json:"forecast"`
 }
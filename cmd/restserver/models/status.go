@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IngestRun loaded model run
+type IngestRun struct {
+	Run           time.Time  `json:"run"`
+	Status        string     `json:"status"`
+	StartedAt     time.Time  `json:"started-at"`
+	FinishedAt    *time.Time `json:"finished-at,omitempty"`
+	StepsComplete int        `json:"steps-complete"`
+	StepsFailed   int        `json:"steps-failed"`
+	Rows          int64      `json:"rows"`
+}
+
+type StatusResponse struct {
+	// Latest newest complete run
+	Latest *IngestRun `json:"latest"`
+	// Age seconds from Latest run reference time
+	Age  int64       `json:"age,omitempty"`
+	Runs []IngestRun `json:"runs"`
+}
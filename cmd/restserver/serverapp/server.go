@@ -19,6 +19,10 @@ type WKTHandler interface {
 	HandlerByWKT(c *gin.Context)
 }
 
+type StatusHandler interface {
+	HandlerStatus(c *gin.Context)
+}
+
 type ServerApp struct {
 	srv    *http.Server
 	router *gin.Engine
@@ -27,11 +31,13 @@ type ServerApp struct {
 func New(
 	apiBasePath string,
 	wktHandler WKTHandler,
+	statusHandler StatusHandler,
 ) *ServerApp {
 
 	router := gin.Default()
 	apiNoAuth := router.Group(apiBasePath)
 	apiNoAuth.POST("/bywkt", wktHandler.HandlerByWKT)
+	apiNoAuth.GET("/status", statusHandler.HandlerStatus)
 
 	return &ServerApp{
 		router: router,
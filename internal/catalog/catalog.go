@@ -0,0 +1,324 @@
+// Package catalog describe GRIB variables: where to find them in GFS files,
+// how to convert them and where to store them
+package catalog
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed catalog.yml
+var defaultCatalog []byte
+
+var (
+	ErrReadCatalog    = errors.New("catalog: failed to read catalog")
+	ErrInvalidCatalog = errors.New("catalog: invalid catalog")
+	ErrUnknownName    = errors.New("catalog: unknown variable")
+)
+
+var (
+	identifierRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+	// reservedColumns "records" table columns not available for variables
+	reservedColumns = map[string]struct{}{
+		"id":        {},
+		"grid_id":   {},
+		"date_time": {},
+		"run_time":  {},
+		"lead_time": {},
+		"is_ground": {},
+		"level":     {},
+	}
+)
+
+// GRIB models of variables
+const (
+	ModelAtmos = "atmos"
+	// ModelWave GFS-Wave variables, stored over sea cells only
+	ModelWave = "wave"
+)
+
+// LevelIsobaric level of 3D variables loaded on isobaric levels ("850 mb", ...)
+const LevelIsobaric = "isobaric"
+
+// Accumulations of variables read from accumulated or averaged GRIB messages
+// ("0-6 hour acc", "0-6 hour ave"). Values are computed over the interval from
+// the previous forecast hour
+const (
+	// AccumulationAmount value accumulated over the interval (mean × hours for averaged messages)
+	AccumulationAmount = "amount"
+	// AccumulationRate amount per hour (mean over the interval for averaged messages)
+	AccumulationRate = "rate"
+)
+
+// Interpolations of variables between stored forecast steps. Accumulated
+// variables are spread over the steps instead
+const (
+	InterpolationLinear = "linear"
+	// InterpolationCircular angle in degrees interpolated along the shorter arc
+	InterpolationCircular = "circular"
+)
+
+type Conversion func(float64) float64
+
+var conversions = map[string]Conversion{
+	"":                    func(v float64) float64 { return v },
+	"identity":            func(v float64) float64 { return v },
+	"kelvin_to_celsius":   func(v float64) float64 { return v - 273.15 },
+	"pa_to_hpa":           func(v float64) float64 { return v / 100 },
+	"m_to_km":             func(v float64) float64 { return v / 1000 },
+	"fraction_to_percent": func(v float64) float64 { return v * 100 },
+}
+
+type Variable struct {
+	Name       string `yaml:"name"`
+	Model      string `yaml:"model"`
+	Component  string `yaml:"component"`
+	Param      string `yaml:"param"`
+	Level      string `yaml:"level"`
+	Units      string `yaml:"units"`
+	Conversion string `yaml:"conversion"`
+	// Accumulation empty, AccumulationAmount or AccumulationRate
+	Accumulation string `yaml:"accumulation"`
+	// Derive derivation computing variable from Inputs instead of GRIB message
+	Derive string `yaml:"derive"`
+	// Inputs names of variables Derive is computed from
+	Inputs []string `yaml:"inputs"`
+	// Interpolation InterpolationLinear or InterpolationCircular
+	Interpolation string `yaml:"interpolation"`
+	Column        string `yaml:"column"`
+	Output        string `yaml:"output"`
+}
+
+// Convert apply variable conversion to raw GRIB value
+func (v Variable) Convert(value float64) float64 {
+	return conversions[v.Conversion](value)
+}
+
+// Isobaric check variable is loaded on isobaric levels
+func (v Variable) Isobaric() bool {
+	return v.Level == LevelIsobaric
+}
+
+// Accumulated check variable is read from accumulated or averaged messages
+func (v Variable) Accumulated() bool {
+	return v.Accumulation != ""
+}
+
+// Layer return .idx level of variable. hPa is used by isobaric variables only
+func (v Variable) Layer(hPa int) string {
+	if v.Isobaric() {
+		return fmt.Sprintf("%d mb", hPa)
+	}
+	return v.Level
+}
+
+// OutputPath return response object and field. Object is empty for top-level fields
+func (v Variable) OutputPath() (object string, field string) {
+	if i := strings.IndexByte(v.Output, '.'); i >= 0 {
+		return v.Output[:i], v.Output[i+1:]
+	}
+	return "", v.Output
+}
+
+type Catalog struct {
+	Variables []Variable `yaml:"variables"`
+}
+
+// Default return built-in catalog
+func Default() *Catalog {
+	c, err := parse(defaultCatalog)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Load read catalog file. Empty path means built-in catalog
+func Load(path string) (*Catalog, error) {
+	if path == "" {
+		return Default(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Join(ErrReadCatalog, err)
+	}
+
+	return parse(data)
+}
+
+func parse(data []byte) (*Catalog, error) {
+	var c Catalog
+	err := yaml.Unmarshal(data, &c)
+	if err != nil {
+		return nil, errors.Join(ErrReadCatalog, err)
+	}
+
+	for i := range c.Variables {
+		v := &c.Variables[i]
+		if v.Component == "" {
+			v.Component = v.Name
+		}
+		if v.Output == "" {
+			v.Output = v.Name
+		}
+		if v.Model == "" {
+			v.Model = ModelAtmos
+		}
+		if v.Interpolation == "" {
+			v.Interpolation = InterpolationLinear
+		}
+	}
+
+	err = c.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// Validate check names, columns and conversions
+func (c *Catalog) Validate() error {
+	var errs []error
+
+	names := make(map[string]struct{}, len(c.Variables))
+	columns := make(map[string]struct{}, len(c.Variables))
+	sources := make(map[string]struct{}, len(c.Variables))
+
+	for i, v := range c.Variables {
+		prefix := fmt.Sprintf("variable %d (%s)", i, v.Name)
+
+		if v.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: name is required", prefix))
+		} else if _, ok := names[v.Name]; ok {
+			errs = append(errs, fmt.Errorf("%s: duplicate name", prefix))
+		}
+		names[v.Name] = struct{}{}
+
+		if v.Derived() {
+			errs = append(errs, c.validateDerived(i, prefix)...)
+		} else if v.Param == "" || v.Level == "" {
+			errs = append(errs, fmt.Errorf("%s: param and level are required", prefix))
+		}
+		if v.Model != ModelAtmos && v.Model != ModelWave {
+			errs = append(errs, fmt.Errorf("%s: unknown model %q", prefix, v.Model))
+		}
+		if v.Isobaric() && v.Model != ModelAtmos {
+			errs = append(errs, fmt.Errorf("%s: isobaric levels require model %s", prefix, ModelAtmos))
+		}
+
+		switch v.Accumulation {
+		case "", AccumulationAmount, AccumulationRate:
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown accumulation %q", prefix, v.Accumulation))
+		}
+		if v.Interpolation != InterpolationLinear && v.Interpolation != InterpolationCircular {
+			errs = append(errs, fmt.Errorf("%s: unknown interpolation %q", prefix, v.Interpolation))
+		}
+		if v.Accumulated() && (v.Model != ModelAtmos || v.Isobaric()) {
+			errs = append(errs, fmt.Errorf("%s: accumulation requires model %s on a single level", prefix, ModelAtmos))
+		}
+
+		if !v.Derived() {
+			source := v.Model + ":" + v.Param + ":" + v.Level + ":" + v.Accumulation
+			if _, ok := sources[source]; ok {
+				errs = append(errs, fmt.Errorf("%s: duplicate %s", prefix, source))
+			}
+			sources[source] = struct{}{}
+		}
+
+		if !identifierRe.MatchString(v.Column) {
+			errs = append(errs, fmt.Errorf("%s: bad column name %q", prefix, v.Column))
+		} else if _, ok := reservedColumns[v.Column]; ok {
+			errs = append(errs, fmt.Errorf("%s: column %q is reserved", prefix, v.Column))
+		} else if _, ok := columns[v.Column]; ok {
+			errs = append(errs, fmt.Errorf("%s: duplicate column %q", prefix, v.Column))
+		}
+		columns[v.Column] = struct{}{}
+
+		if _, ok := conversions[v.Conversion]; !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown conversion %q", prefix, v.Conversion))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(append([]error{ErrInvalidCatalog}, errs...)...)
+	}
+	return nil
+}
+
+// Filter return catalog with variables for which keep is true. Derived
+// variables are dropped with their inputs
+func (c *Catalog) Filter(keep func(v Variable) bool) *Catalog {
+	res := &Catalog{
+		Variables: make([]Variable, 0, len(c.Variables)),
+	}
+	kept := make(map[string]struct{}, len(c.Variables))
+	for _, v := range c.Variables {
+		if !keep(v) {
+			continue
+		}
+		missing := false
+		for _, input := range v.Inputs {
+			if _, ok := kept[input]; !ok {
+				missing = true
+			}
+		}
+		if missing {
+			continue
+		}
+		kept[v.Name] = struct{}{}
+		res.Variables = append(res.Variables, v)
+	}
+	return res
+}
+
+// WithoutModel return catalog without variables of model
+func (c *Catalog) WithoutModel(model string) *Catalog {
+	return c.Filter(func(v Variable) bool { return v.Model != model })
+}
+
+// Get return variable by name
+func (c *Catalog) Get(name string) (Variable, bool) {
+	for _, v := range c.Variables {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variable{}, false
+}
+
+// Select return variables matching REST components. Empty list means all variables
+func (c *Catalog) Select(components []string) ([]Variable, error) {
+	if len(components) == 0 {
+		return c.Variables, nil
+	}
+
+	result := make([]Variable, 0, len(components))
+	seen := make(map[string]struct{}, len(components))
+	for _, component := range components {
+		found := false
+		for _, v := range c.Variables {
+			if v.Component == component || v.Name == component {
+				found = true
+				if _, ok := seen[v.Name]; !ok {
+					seen[v.Name] = struct{}{}
+					result = append(result, v)
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownName, component)
+		}
+	}
+
+	return result, nil
+}
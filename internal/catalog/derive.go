@@ -0,0 +1,137 @@
+package catalog
+
+import (
+	"fmt"
+	"math"
+)
+
+// Derivation compute variable from input values given in units of the built-in
+// catalog (°C, %, m/s, Pa, m)
+type Derivation struct {
+	// Inputs number of input variables
+	Inputs int
+	Fn     func(in []float64) float64
+}
+
+var derivations = map[string]Derivation{
+	// wind_speed: u (m/s), v (m/s)
+	"wind_speed": {2, func(in []float64) float64 {
+		return math.Hypot(in[0], in[1])
+	}},
+	// wind_direction: u (m/s), v (m/s). Direction the wind blows from, degrees clockwise from north
+	"wind_direction": {2, func(in []float64) float64 {
+		return windDirection(in[0], in[1])
+	}},
+	// dew_point: temperature (°C), relative humidity (%)
+	"dew_point": {2, func(in []float64) float64 {
+		return dewPoint(in[0], in[1])
+	}},
+	// apparent_temperature: temperature (°C), relative humidity (%), u (m/s), v (m/s)
+	"apparent_temperature": {4, func(in []float64) float64 {
+		return apparentTemperature(in[0], in[1], math.Hypot(in[2], in[3]))
+	}},
+	// station_pressure: mean sea level pressure (Pa), temperature (°C), elevation (m)
+	"station_pressure": {3, func(in []float64) float64 {
+		return stationPressure(in[0], in[1], in[2])
+	}},
+}
+
+// Derived check variable is computed from other variables
+func (v Variable) Derived() bool {
+	return v.Derive != ""
+}
+
+// Compute apply derivation of variable to converted input values. Result is
+// stored as is, conversion of variable is applied on read
+func (v Variable) Compute(inputs []float64) float64 {
+	return derivations[v.Derive].Fn(inputs)
+}
+
+func (c *Catalog) validateDerived(i int, prefix string) []error {
+	var errs []error
+
+	v := c.Variables[i]
+	d, ok := derivations[v.Derive]
+	if !ok {
+		return []error{fmt.Errorf("%s: unknown derivation %q", prefix, v.Derive)}
+	}
+
+	if v.Param != "" || v.Level != "" || v.Accumulated() {
+		errs = append(errs, fmt.Errorf("%s: derived variable has no param, level and accumulation", prefix))
+	}
+	if len(v.Inputs) != d.Inputs {
+		errs = append(errs, fmt.Errorf("%s: %s requires %d inputs", prefix, v.Derive, d.Inputs))
+	}
+
+	for _, name := range v.Inputs {
+		found := false
+		for _, input := range c.Variables[:i] {
+			if input.Name == name {
+				found = true
+				if input.Isobaric() {
+					errs = append(errs, fmt.Errorf("%s: input %q is isobaric", prefix, name))
+				}
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Errorf("%s: input %q must be declared before", prefix, name))
+		}
+	}
+
+	return errs
+}
+
+func windDirection(u, v float64) float64 {
+	if u == 0 && v == 0 {
+		return 0
+	}
+	return math.Mod(math.Atan2(-u, -v)*180/math.Pi+360, 360)
+}
+
+// dewPoint Magnus formula
+func dewPoint(t, rh float64) float64 {
+	const a, b = 17.625, 243.04
+	g := math.Log(rh/100) + a*t/(b+t)
+	return b * g / (a - g)
+}
+
+// apparentTemperature NWS heat index above 26.7 °C, wind chill at or below 10 °C
+// with wind over 4.8 km/h, air temperature otherwise. windSpeed in m/s
+func apparentTemperature(t, rh, windSpeed float64) float64 {
+	switch kmh := windSpeed * 3.6; {
+	case t <= 10 && kmh > 4.8:
+		k := math.Pow(kmh, 0.16)
+		return 13.12 + 0.6215*t - 11.37*k + 0.3965*t*k
+	case t >= 26.7:
+		return (heatIndex(t*9/5+32, rh) - 32) * 5 / 9
+	default:
+		return t
+	}
+}
+
+// heatIndex NWS Rothfusz regression with adjustments, f in °F
+func heatIndex(f, rh float64) float64 {
+	hi := 0.5 * (f + 61 + (f-68)*1.2 + rh*0.094)
+	if (hi+f)/2 < 80 {
+		return hi
+	}
+
+	hi = -42.379 + 2.04901523*f + 10.14333127*rh - 0.22475541*f*rh -
+		0.00683783*f*f - 0.05481717*rh*rh + 0.00122874*f*f*rh +
+		0.00085282*f*rh*rh - 0.00000199*f*f*rh*rh
+	switch {
+	case rh < 13 && f >= 80 && f <= 112:
+		hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(f-95))/17)
+	case rh > 85 && f >= 80 && f <= 87:
+		hi += (rh - 85) / 10 * (87 - f) / 5
+	}
+	return hi
+}
+
+// stationPressure reduce mean sea level pressure to elevation z with standard
+// lapse rate and temperature t (°C) at the station
+func stationPressure(msl, t, z float64) float64 {
+	const lapse, exponent = 0.0065, 5.257
+	tk := t + 273.15
+	return msl * math.Pow(1-lapse*z/(tk+lapse*z), exponent)
+}
@@ -0,0 +1,309 @@
+// Package grid keep decoded GRIB fields as dense arrays
+package grid
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/nilsmagnus/grib/griblib"
+)
+
+const (
+	// microDegrees GRIB2 template 3.0 angle unit
+	microDegrees = 1000000.0
+
+	// scanning mode flag: points of first row scan south to north
+	scanSouthToNorth = 0x40
+	// scanning mode flag: points scan east to west
+	scanEastToWest = 0x80
+
+	// bitmapPresent section 6 indicator: bitmap applies to the message
+	bitmapPresent = 0
+)
+
+var (
+	ErrGridTemplate = errors.New("grid: unsupported grid template")
+	ErrDataSize     = errors.New("grid: data size mismatch")
+	ErrNotAligned   = errors.New("grid: fields grids differ")
+)
+
+// Field decoded field. Value of point (i, j) is Data[j*Ni+i]. Points of
+// regular lat/lon grid are Lat0+j*DLat, Lng0+i*DLng, points of other grids are
+// given by Proj. Missing values (e.g. land points of wave fields) are NaN
+type Field struct {
+	Ni   int
+	Nj   int
+	Lat0 float32
+	Lng0 float32
+	DLat float32
+	DLng float32
+	// Proj projection of grid, nil for regular lat/lon grid
+	Proj Projection
+	Data []float32
+}
+
+// NewField create field from GRIB message. Templates 3.0 (lat/lon), 3.20
+// (polar stereographic), 3.30 (Lambert conformal) and 3.40 (Gaussian) are
+// supported. griblib does not read rotated lat/lon grids (3.1), ReadFields
+// decodes them
+func NewField(msg *griblib.Message) (*Field, error) {
+	data := messageValues(msg)
+	switch def := msg.Section3.Definition.(type) {
+	case *griblib.Grid0:
+		return NewFieldGrid0(def, data)
+	case *griblib.Grid20:
+		ni, nj := int(def.Nx), int(def.Ny)
+		return NewFieldProjected(ni, nj, NewPolarStereographic(def), reorder(data, ni, nj, def.ScanningMode))
+	case *griblib.Grid30:
+		ni, nj := int(def.Nx), int(def.Ny)
+		return NewFieldProjected(ni, nj, NewLambertConformal(def), reorder(data, ni, nj, def.ScanningMode))
+	case *griblib.Grid40:
+		ni, nj := int(def.Ni), int(def.Nj)
+		return NewFieldProjected(ni, nj, NewGaussian(def), reorder(data, ni, nj, def.ScanningMode))
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrGridTemplate, msg.Section3.Definition)
+	}
+}
+
+// NewFieldProjected create field of ni*nj points of proj from values in Data order
+func NewFieldProjected(ni, nj int, proj Projection, data []float64) (*Field, error) {
+	if len(data) != ni*nj {
+		return nil, fmt.Errorf("%w: %d values for %dx%d grid", ErrDataSize, len(data), ni, nj)
+	}
+
+	f := &Field{
+		Ni:   ni,
+		Nj:   nj,
+		Proj: proj,
+		Data: make([]float32, len(data)),
+	}
+	for n, v := range data {
+		f.Data[n] = float32(v)
+	}
+	return f, nil
+}
+
+// messageValues return one value per grid point: values missing in bitmap or
+// equal to the missing value substitute are NaN
+func messageValues(msg *griblib.Message) []float64 {
+	data := msg.Data()
+
+	// templates 5.2 and 5.3: octet 23 is missing value management, 24-27 primary substitute
+	tmpl := msg.Section5.Data
+	if n := msg.Section5.DataTemplateNumber; (n == 2 || n == 3) && len(tmpl) >= 16 && (tmpl[11] == 1 || tmpl[11] == 2) {
+		missing := float64(binary.BigEndian.Uint32(tmpl[12:16]))
+		for i, v := range data {
+			if v == missing {
+				data[i] = math.NaN()
+			}
+		}
+	}
+
+	if msg.Section6.BitmapIndicator != bitmapPresent {
+		return data
+	}
+
+	bitmap := msg.Section6.Bitmap
+	points := int(msg.Section3.DataPointCount)
+	if points > len(bitmap)*8 {
+		return data
+	}
+
+	values := make([]float64, points)
+	k := 0
+	for n := range values {
+		if bitmap[n/8]&(0x80>>(n%8)) == 0 || k >= len(data) {
+			values[n] = math.NaN()
+			continue
+		}
+		values[n] = data[k]
+		k++
+	}
+	return values
+}
+
+// NewFieldGrid0 create field from template 3.0 definition and decoded values
+func NewFieldGrid0(def *griblib.Grid0, data []float64) (*Field, error) {
+	ni, nj := int(def.Ni), int(def.Nj)
+	if len(data) != ni*nj {
+		return nil, fmt.Errorf("%w: %d values for %dx%d grid", ErrDataSize, len(data), ni, nj)
+	}
+	data = reorder(data, ni, nj, def.ScanningMode)
+
+	f := &Field{
+		Ni:   ni,
+		Nj:   nj,
+		Lat0: float32(def.La1) / microDegrees,
+		Lng0: float32(def.Lo1) / microDegrees,
+		DLat: -float32(def.Dj) / microDegrees,
+		DLng: float32(def.Di) / microDegrees,
+		Data: make([]float32, len(data)),
+	}
+
+	if def.ScanningMode&scanSouthToNorth != 0 {
+		f.DLat = -f.DLat
+	}
+	if def.ScanningMode&scanEastToWest != 0 {
+		f.DLng = -f.DLng
+	}
+
+	for n, v := range data {
+		f.Data[n] = float32(v)
+	}
+
+	return f, nil
+}
+
+// Len return points count
+func (f *Field) Len() int {
+	return len(f.Data)
+}
+
+// Projected check field is not on regular lat/lon grid
+func (f *Field) Projected() bool {
+	return f.Proj != nil
+}
+
+// Coord return coordinates of point n (n = j*Ni+i)
+func (f *Field) Coord(n int) (lat, lng float32) {
+	i, j := n%f.Ni, n/f.Ni
+	if f.Proj != nil {
+		la, lo := f.Proj.LatLng(float64(i), float64(j))
+		return float32(la), float32(lo)
+	}
+	return f.Lat0 + float32(j)*f.DLat, f.Lng0 + float32(i)*f.DLng
+}
+
+// Aligned check fields have the same grid
+func (f *Field) Aligned(o *Field) bool {
+	return f.Ni == o.Ni && f.Nj == o.Nj &&
+		f.Lat0 == o.Lat0 && f.Lng0 == o.Lng0 &&
+		f.DLat == o.DLat && f.DLng == o.DLng &&
+		f.Proj == o.Proj
+}
+
+// Cover return empty regular lat/lon field of step degrees covering points of
+// f, north to south and west to east. Longitudes are -180..180 unless f
+// crosses the antimeridian
+func (f *Field) Cover(step float32) *Field {
+	minLat, maxLat := float32(90), float32(-90)
+	var lngs []float32
+	for n := range f.Data {
+		lat, lng := f.Coord(n)
+		minLat, maxLat = min(minLat, lat), max(maxLat, lat)
+		lngs = append(lngs, lng)
+	}
+
+	minLng, maxLng := float32(180), float32(-180)
+	for _, lng := range lngs {
+		minLng, maxLng = min(minLng, lng), max(maxLng, lng)
+	}
+	// grid crossing the antimeridian is continuous in 0..360
+	if maxLng-minLng > 180 {
+		minLng, maxLng = 360, 0
+		for _, lng := range lngs {
+			if lng < 0 {
+				lng += 360
+			}
+			minLng, maxLng = min(minLng, lng), max(maxLng, lng)
+		}
+	}
+
+	lat0 := min(float32(math.Ceil(float64(maxLat/step)))*step, 90)
+	lng0 := float32(math.Floor(float64(minLng/step))) * step
+	ni := int(math.Ceil(float64((maxLng-lng0)/step))) + 1
+	nj := int(math.Ceil(float64((lat0-minLat)/step))) + 1
+	if wrap := int(math.Round(float64(360 / step))); ni > wrap {
+		ni = wrap
+	}
+
+	return &Field{
+		Ni:   ni,
+		Nj:   nj,
+		Lat0: lat0,
+		Lng0: lng0,
+		DLat: -step,
+		DLng: step,
+		Data: make([]float32, ni*nj),
+	}
+}
+
+// index return the nearest point of f to coordinates, ok is false when
+// coordinates are outside f
+func (f *Field) index(lat, lng float32) (n int, ok bool) {
+	var fi, fj float64
+	if f.Proj != nil {
+		fi, fj = f.Proj.Index(float64(lat), float64(lng))
+	} else {
+		fi, fj = float64((lng-f.Lng0)/f.DLng), float64((lat-f.Lat0)/f.DLat)
+	}
+	i, j := int(math.Round(fi)), int(math.Round(fj))
+
+	// longitudes wrap when regular f covers the whole circle
+	if f.Proj == nil {
+		if wrap := int(math.Round(360 / math.Abs(float64(f.DLng)))); wrap == f.Ni {
+			i = ((i % wrap) + wrap) % wrap
+		}
+	}
+
+	if i < 0 || i >= f.Ni || j < 0 || j >= f.Nj {
+		return 0, false
+	}
+	return j*f.Ni + i, true
+}
+
+// Resample return field on grid of target taking the nearest point of f.
+// Points outside f are NaN. Return f when grids are the same
+func (f *Field) Resample(target *Field) *Field {
+	if f.Aligned(target) {
+		return f
+	}
+
+	res := &Field{
+		Ni:   target.Ni,
+		Nj:   target.Nj,
+		Lat0: target.Lat0,
+		Lng0: target.Lng0,
+		DLat: target.DLat,
+		DLng: target.DLng,
+		Proj: target.Proj,
+		Data: make([]float32, target.Len()),
+	}
+
+	for n := range res.Data {
+		k, ok := f.index(res.Coord(n))
+		if !ok {
+			res.Data[n] = float32(math.NaN())
+			continue
+		}
+		res.Data[n] = f.Data[k]
+	}
+
+	return res
+}
+
+// Map return field with fn of every value
+func (f *Field) Map(fn func(v float32) float32) *Field {
+	res := *f
+	res.Data = make([]float32, len(f.Data))
+	for n, v := range f.Data {
+		res.Data[n] = fn(v)
+	}
+	return &res
+}
+
+// Combine return field with fn of values of f and o at every point
+func (f *Field) Combine(o *Field, fn func(a, b float32) float32) (*Field, error) {
+	if !f.Aligned(o) {
+		return nil, ErrNotAligned
+	}
+
+	res := *f
+	res.Data = make([]float32, len(f.Data))
+	for n, v := range f.Data {
+		res.Data[n] = fn(v, o.Data[n])
+	}
+	return &res, nil
+}
@@ -0,0 +1,42 @@
+package grid
+
+import (
+	"testing"
+
+	"github.com/nilsmagnus/grib/griblib"
+)
+
+// gfsMessage message of 0.5° GFS grid: 720x361 points from 90N, 0E
+func gfsMessage() *griblib.Message {
+	def := &griblib.Grid0{
+		Ni:  720,
+		Nj:  361,
+		La1: 90 * microDegrees,
+		Lo1: 0,
+		La2: -90 * microDegrees,
+		Lo2: 359.5 * microDegrees,
+		Di:  0.5 * microDegrees,
+		Dj:  0.5 * microDegrees,
+	}
+	data := make([]float64, def.Ni*def.Nj)
+	for n := range data {
+		data[n] = 273.15 + float64(n%1000)/100
+	}
+
+	msg := &griblib.Message{}
+	msg.Section3.Definition = def
+	msg.Section3.DataPointCount = uint32(len(data))
+	msg.Section6.BitmapIndicator = 255
+	msg.Section7.Data = data
+	return msg
+}
+
+func BenchmarkNewField(b *testing.B) {
+	msg := gfsMessage()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewField(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package grid
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/nilsmagnus/grib/griblib"
+)
+
+const (
+	// scanning mode flag: adjacent points of j direction are consecutive
+	scanColumns = 0x20
+	// scanning mode flag: adjacent rows scan in opposite directions
+	scanBoustrophedon = 0x10
+
+	// projection centre flag: south pole is on the projection plane
+	projectionSouthPole = 0x80
+
+	// milliMeters GRIB2 templates 3.20 and 3.30 grid length unit
+	milliMeters = 1000.0
+
+	degToRad = math.Pi / 180
+)
+
+// Projection map grid indices to coordinates and back. Implementations are
+// comparable values, equal projections describe the same grid. Index i runs along
+// rows and j along columns in scanning order of the first point, so point
+// (i, j) is stored at Data[j*Ni+i]
+type Projection interface {
+	// LatLng return coordinates of grid point (i, j)
+	LatLng(i, j float64) (lat, lng float64)
+	// Index return fractional grid indices of coordinates
+	Index(lat, lng float64) (i, j float64)
+}
+
+// earthRadius radius of spherical earth of grid definition. Oblate spheroids
+// are approximated by sphere of WMO radius
+func earthRadius(h griblib.GridHeader) float64 {
+	switch h.EarthShape {
+	case 0:
+		return 6367470
+	case 1:
+		if r := scaled(h.SphericalRadius); r > 0 {
+			return r
+		}
+	case 8:
+		return 6371200
+	}
+	return 6371229
+}
+
+func scaled(v griblib.ScaledValue) float64 {
+	return float64(v.Value) / math.Pow10(int(v.Scale))
+}
+
+// signMagnitude decode GRIB2 signed value: the most significant bit is the sign
+func signMagnitude(v uint32) float64 {
+	if v&0x80000000 != 0 {
+		return -float64(v &^ 0x80000000)
+	}
+	return float64(v)
+}
+
+// scanSigns direction of i and j increments in projection plane
+func scanSigns(scanningMode uint8) (si, sj float64) {
+	si, sj = 1, -1
+	if scanningMode&scanEastToWest != 0 {
+		si = -1
+	}
+	if scanningMode&scanSouthToNorth != 0 {
+		sj = 1
+	}
+	return si, sj
+}
+
+// reorder move values of scanning mode to Data order: rows of i, first point
+// first. Only transposition and boustrophedon rows need moving, directions of
+// i and j are handled by projections
+func reorder(data []float64, ni, nj int, scanningMode uint8) []float64 {
+	if scanningMode&(scanColumns|scanBoustrophedon) == 0 {
+		return data
+	}
+
+	res := make([]float64, len(data))
+	for n, v := range data {
+		var i, j int
+		if scanningMode&scanColumns != 0 {
+			i, j = n/nj, n%nj
+			if scanningMode&scanBoustrophedon != 0 && i%2 == 1 {
+				j = nj - 1 - j
+			}
+		} else {
+			i, j = n%ni, n/ni
+			if scanningMode&scanBoustrophedon != 0 && j%2 == 1 {
+				i = ni - 1 - i
+			}
+		}
+		res[j*ni+i] = v
+	}
+	return res
+}
+
+// planar grid of equally spaced points on projection plane
+type planar struct {
+	x1, y1 float64
+	dx, dy float64
+}
+
+func (p planar) xy(i, j float64) (x, y float64) {
+	return p.x1 + i*p.dx, p.y1 + j*p.dy
+}
+
+func (p planar) ij(x, y float64) (i, j float64) {
+	return (x - p.x1) / p.dx, (y - p.y1) / p.dy
+}
+
+// LambertConformal template 3.30 projection on sphere
+type LambertConformal struct {
+	planar
+	radius float64
+	// lov orientation longitude, n cone constant, f scale factor (radians)
+	lov, n, f float64
+}
+
+// NewLambertConformal create projection of template 3.30 definition
+func NewLambertConformal(def *griblib.Grid30) LambertConformal {
+	p := LambertConformal{
+		radius: earthRadius(def.GridHeader),
+		lov:    float64(def.Lov) / microDegrees * degToRad,
+	}
+
+	latin1 := signMagnitude(def.Latin1) / microDegrees * degToRad
+	latin2 := signMagnitude(def.Latin2) / microDegrees * degToRad
+	if math.Abs(latin1-latin2) < 1e-9 {
+		p.n = math.Sin(latin1)
+	} else {
+		p.n = math.Log(math.Cos(latin1)/math.Cos(latin2)) /
+			math.Log(math.Tan(math.Pi/4+latin2/2)/math.Tan(math.Pi/4+latin1/2))
+	}
+	p.f = math.Cos(latin1) * math.Pow(math.Tan(math.Pi/4+latin1/2), p.n) / p.n
+
+	si, sj := scanSigns(def.ScanningMode)
+	p.dx = si * float64(def.Dx) / milliMeters
+	p.dy = sj * float64(def.Dy) / milliMeters
+	p.x1, p.y1 = p.forward(float64(def.La1)/microDegrees, float64(def.Lo1)/microDegrees)
+
+	return p
+}
+
+func (p LambertConformal) forward(lat, lng float64) (x, y float64) {
+	rho := p.radius * p.f / math.Pow(math.Tan(math.Pi/4+lat*degToRad/2), p.n)
+	theta := p.n * normalizeRadians(lng*degToRad-p.lov)
+	return rho * math.Sin(theta), -rho * math.Cos(theta)
+}
+
+func (p LambertConformal) LatLng(i, j float64) (lat, lng float64) {
+	x, y := p.xy(i, j)
+	rho := math.Copysign(math.Hypot(x, y), p.n)
+	theta := math.Atan2(x, -y)
+	if p.n < 0 {
+		theta = math.Atan2(-x, y)
+	}
+	lat = 2*math.Atan(math.Pow(p.radius*p.f/rho, 1/p.n)) - math.Pi/2
+	lng = p.lov + theta/p.n
+	return lat / degToRad, normalizeDegrees(lng / degToRad)
+}
+
+func (p LambertConformal) Index(lat, lng float64) (i, j float64) {
+	return p.ij(p.forward(lat, lng))
+}
+
+// PolarStereographic template 3.20 projection on sphere
+type PolarStereographic struct {
+	planar
+	radius float64
+	// lov orientation longitude (radians), k scale at true latitude
+	lov, k float64
+	south  bool
+}
+
+// NewPolarStereographic create projection of template 3.20 definition
+func NewPolarStereographic(def *griblib.Grid20) PolarStereographic {
+	p := PolarStereographic{
+		radius: earthRadius(def.GridHeader),
+		lov:    float64(def.Lov) / microDegrees * degToRad,
+		south:  def.ProjectionCenter&projectionSouthPole != 0,
+	}
+
+	lad := float64(def.Lad) / microDegrees * degToRad
+	if p.south {
+		lad = -lad
+	}
+	p.k = 1 + math.Sin(lad)
+
+	si, sj := scanSigns(def.ScanningMode)
+	p.dx = si * float64(def.Dx) / milliMeters
+	p.dy = sj * float64(def.Dy) / milliMeters
+	p.x1, p.y1 = p.forward(float64(def.La1)/microDegrees, float64(def.Lo1)/microDegrees)
+
+	return p
+}
+
+func (p PolarStereographic) forward(lat, lng float64) (x, y float64) {
+	phi := lat * degToRad
+	if p.south {
+		phi = -phi
+	}
+	rho := p.radius * p.k * math.Tan(math.Pi/4-phi/2)
+	theta := lng*degToRad - p.lov
+	if p.south {
+		return rho * math.Sin(theta), rho * math.Cos(theta)
+	}
+	return rho * math.Sin(theta), -rho * math.Cos(theta)
+}
+
+func (p PolarStereographic) LatLng(i, j float64) (lat, lng float64) {
+	x, y := p.xy(i, j)
+	if p.south {
+		y = -y
+	}
+	lat = math.Pi/2 - 2*math.Atan(math.Hypot(x, y)/(p.radius*p.k))
+	lng = p.lov + math.Atan2(x, -y)
+	if p.south {
+		lat = -lat
+	}
+	return lat / degToRad, normalizeDegrees(lng / degToRad)
+}
+
+func (p PolarStereographic) Index(lat, lng float64) (i, j float64) {
+	return p.ij(p.forward(lat, lng))
+}
+
+// RotatedLatLng template 3.1 grid: regular lat/lng grid in coordinates with
+// south pole moved to SouthPoleLat, SouthPoleLng and rotated by Angle (degrees)
+type RotatedLatLng struct {
+	Lat0, Lng0, DLat, DLng float64
+	SouthPoleLat           float64
+	SouthPoleLng           float64
+	Angle                  float64
+}
+
+func (p RotatedLatLng) LatLng(i, j float64) (lat, lng float64) {
+	return p.unrotate(p.Lat0+j*p.DLat, p.Lng0+i*p.DLng+p.Angle)
+}
+
+func (p RotatedLatLng) Index(lat, lng float64) (i, j float64) {
+	rlat, rlng := p.rotate(lat, lng)
+	return normalizeDegrees(rlng-p.Angle-p.Lng0) / p.DLng, (rlat - p.Lat0) / p.DLat
+}
+
+// unrotate return geographic coordinates of rotated ones
+func (p RotatedLatLng) unrotate(rlat, rlng float64) (lat, lng float64) {
+	beta := -(90 + p.SouthPoleLat) * degToRad
+	x, y, z := cartesian(rlat, rlng)
+	x, z = x*math.Cos(beta)+z*math.Sin(beta), -x*math.Sin(beta)+z*math.Cos(beta)
+	lat, lng = spherical(x, y, z)
+	return lat, normalizeDegrees(lng + p.SouthPoleLng)
+}
+
+// rotate return rotated coordinates of geographic ones
+func (p RotatedLatLng) rotate(lat, lng float64) (rlat, rlng float64) {
+	beta := -(90 + p.SouthPoleLat) * degToRad
+	x, y, z := cartesian(lat, lng-p.SouthPoleLng)
+	x, z = x*math.Cos(beta)-z*math.Sin(beta), x*math.Sin(beta)+z*math.Cos(beta)
+	return spherical(x, y, z)
+}
+
+func cartesian(lat, lng float64) (x, y, z float64) {
+	phi, lambda := lat*degToRad, lng*degToRad
+	return math.Cos(phi) * math.Cos(lambda), math.Cos(phi) * math.Sin(lambda), math.Sin(phi)
+}
+
+func spherical(x, y, z float64) (lat, lng float64) {
+	return math.Asin(math.Max(-1, math.Min(1, z))) / degToRad, math.Atan2(y, x) / degToRad
+}
+
+// Gaussian template 3.40 grid: regular longitudes, latitudes at roots of
+// Legendre polynomial of 2N degree
+type Gaussian struct {
+	// N parallels between pole and equator
+	N int
+	// J0 index of the first row in north to south latitudes, JDir 1 for north
+	// to south rows, -1 for south to north
+	J0, JDir   int
+	Lng0, DLng float64
+}
+
+// NewGaussian create grid of template 3.40 definition
+func NewGaussian(def *griblib.Grid40) Gaussian {
+	g := Gaussian{
+		N:    int(def.N),
+		JDir: 1,
+		Lng0: float64(def.Lo1) / microDegrees,
+		DLng: float64(def.Di) / microDegrees,
+	}
+	si, sj := scanSigns(def.ScanningMode)
+	g.DLng *= si
+	if sj > 0 {
+		g.JDir = -1
+	}
+
+	// nearest latitude of the first point
+	lats := gaussianLatitudes(g.N)
+	la1 := float64(def.La1) / microDegrees
+	for k, lat := range lats {
+		if math.Abs(lat-la1) < math.Abs(lats[g.J0]-la1) {
+			g.J0 = k
+		}
+	}
+	return g
+}
+
+func (g Gaussian) LatLng(i, j float64) (lat, lng float64) {
+	lats := gaussianLatitudes(g.N)
+	k := float64(g.J0) + j*float64(g.JDir)
+	k0 := math.Max(0, math.Min(float64(len(lats)-1), math.Floor(k)))
+	k1 := math.Min(float64(len(lats)-1), k0+1)
+	lat = lats[int(k0)] + (k-k0)*(lats[int(k1)]-lats[int(k0)])
+	return lat, normalizeDegrees(g.Lng0 + i*g.DLng)
+}
+
+func (g Gaussian) Index(lat, lng float64) (i, j float64) {
+	lats := gaussianLatitudes(g.N)
+	// latitudes decrease
+	k := sort.Search(len(lats), func(k int) bool { return lats[k] <= lat })
+	var pos float64
+	switch {
+	case k == 0:
+		pos = -1
+	case k == len(lats):
+		pos = float64(len(lats))
+	default:
+		pos = float64(k-1) + (lats[k-1]-lat)/(lats[k-1]-lats[k])
+	}
+	// longitudes of the whole circle from half step before the first one
+	step := math.Abs(g.DLng)
+	d := math.Mod(math.Copysign(1, g.DLng)*(lng-g.Lng0)+step/2, 360)
+	if d < 0 {
+		d += 360
+	}
+	return d/step - 0.5, (pos - float64(g.J0)) / float64(g.JDir)
+}
+
+var gaussianCache sync.Map
+
+// gaussianLatitudes return 2n latitudes (degrees) north to south
+func gaussianLatitudes(n int) []float64 {
+	if lats, ok := gaussianCache.Load(n); ok {
+		return lats.([]float64)
+	}
+
+	size := 2 * n
+	lats := make([]float64, size)
+	for k := 0; k < n; k++ {
+		// Newton iterations from asymptotic root estimate
+		x := math.Cos(math.Pi * (float64(k) + 0.75) / (float64(size) + 0.5))
+		for it := 0; it < 100; it++ {
+			p0, p1 := 1.0, x
+			for l := 2; l <= size; l++ {
+				p0, p1 = p1, ((2*float64(l)-1)*x*p1-(float64(l)-1)*p0)/float64(l)
+			}
+			dp := float64(size) * (x*p1 - p0) / (x*x - 1)
+			dx := p1 / dp
+			x -= dx
+			if math.Abs(dx) < 1e-15 {
+				break
+			}
+		}
+		lat := math.Asin(x) / degToRad
+		lats[k], lats[size-1-k] = lat, -lat
+	}
+
+	gaussianCache.Store(n, lats)
+	return lats
+}
+
+// normalizeRadians move angle to -π..π
+func normalizeRadians(a float64) float64 {
+	return math.Remainder(a, 2*math.Pi)
+}
+
+// normalizeDegrees move longitude to -180..180
+func normalizeDegrees(lng float64) float64 {
+	return math.Remainder(lng, 360)
+}
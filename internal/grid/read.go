@@ -0,0 +1,151 @@
+package grid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/nilsmagnus/grib/griblib"
+)
+
+const (
+	// section 0 length: "GRIB", reserved, discipline, edition, total length
+	indicatorLength = 16
+	// template 3.0 section length, template 3.1 adds 12 octets of rotation
+	grid0Length = 72
+	grid1Length = grid0Length + 12
+)
+
+var ErrMessage = errors.New("grid: bad GRIB2 message")
+
+// ReadFields decode every GRIB2 message of r. griblib does not read rotated
+// lat/lon grids (template 3.1): they are decoded as template 3.0 grids of
+// rotated coordinates and get RotatedLatLng projection
+func ReadFields(r io.Reader) ([]*Field, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data, rotations, err := unrotate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := griblib.ReadMessages(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) != len(rotations) {
+		return nil, fmt.Errorf("%w: griblib read %d of %d messages", ErrMessage, len(msgs), len(rotations))
+	}
+
+	fields := make([]*Field, len(msgs))
+	for n, msg := range msgs {
+		f, err := NewField(msg)
+		if err != nil {
+			return nil, err
+		}
+		if rot := rotations[n]; rot != nil {
+			f = rot.field(f)
+		}
+		fields[n] = f
+	}
+	return fields, nil
+}
+
+// rotation south pole and angle of template 3.1 grid
+type rotation struct {
+	southPoleLat, southPoleLng, angle float64
+}
+
+// field return f of rotated coordinates with RotatedLatLng projection
+func (r *rotation) field(f *Field) *Field {
+	return &Field{
+		Ni: f.Ni,
+		Nj: f.Nj,
+		Proj: RotatedLatLng{
+			Lat0:         float64(f.Lat0),
+			Lng0:         float64(f.Lng0),
+			DLat:         float64(f.DLat),
+			DLng:         float64(f.DLng),
+			SouthPoleLat: r.southPoleLat,
+			SouthPoleLng: r.southPoleLng,
+			Angle:        r.angle,
+		},
+		Data: f.Data,
+	}
+}
+
+// unrotate return GRIB2 stream with template 3.1 grids rewritten to template
+// 3.0 and rotation of every message, nil for not rotated grids
+func unrotate(data []byte) ([]byte, []*rotation, error) {
+	var (
+		res       []byte
+		rotations []*rotation
+	)
+	for {
+		start := bytes.Index(data, []byte("GRIB"))
+		if start < 0 {
+			return res, rotations, nil
+		}
+		data = data[start:]
+		if len(data) < indicatorLength || data[7] != 2 {
+			return nil, nil, fmt.Errorf("%w: not GRIB edition 2", ErrMessage)
+		}
+		length := binary.BigEndian.Uint64(data[8:16])
+		if length < indicatorLength || length > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: length %d of %d bytes", ErrMessage, length, len(data))
+		}
+
+		msg, rot, err := unrotateMessage(data[:length])
+		if err != nil {
+			return nil, nil, err
+		}
+		res = append(res, msg...)
+		rotations = append(rotations, rot)
+		data = data[length:]
+	}
+}
+
+// unrotateMessage rewrite section 3 of template 3.1 to template 3.0. Other
+// messages are returned as is
+func unrotateMessage(msg []byte) ([]byte, *rotation, error) {
+	for pos := indicatorLength; pos+5 <= len(msg); {
+		length := int(binary.BigEndian.Uint32(msg[pos:]))
+		if length < 5 || pos+length > len(msg) {
+			// end section "7777"
+			return msg, nil, nil
+		}
+		if msg[pos+4] != 3 {
+			pos += length
+			continue
+		}
+
+		section := msg[pos : pos+length]
+		if len(section) < 14 || binary.BigEndian.Uint16(section[12:14]) != 1 {
+			return msg, nil, nil
+		}
+		if length != grid1Length {
+			return nil, nil, fmt.Errorf("%w: template 3.1 section of %d octets", ErrMessage, length)
+		}
+
+		rot := &rotation{
+			southPoleLat: signMagnitude(binary.BigEndian.Uint32(section[72:76])) / microDegrees,
+			southPoleLng: float64(binary.BigEndian.Uint32(section[76:80])) / microDegrees,
+			angle:        float64(math.Float32frombits(binary.BigEndian.Uint32(section[80:84]))),
+		}
+
+		res := make([]byte, 0, len(msg)-(grid1Length-grid0Length))
+		res = append(res, msg[:pos+grid0Length]...)
+		res = append(res, msg[pos+length:]...)
+		binary.BigEndian.PutUint64(res[8:16], uint64(len(res)))
+		binary.BigEndian.PutUint32(res[pos:], grid0Length)
+		binary.BigEndian.PutUint16(res[pos+12:], 0)
+		return res, rot, nil
+	}
+	return msg, nil, nil
+}
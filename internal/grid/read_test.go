@@ -0,0 +1,152 @@
+package grid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+// rawMessage GRIB2 message of 4x3 grid from 10N, 20E with 1° steps and
+// simple packed values 0..11. rotation is nil for template 3.0, else south
+// pole latitude, longitude and angle of template 3.1
+func rawMessage(rotation []float64) []byte {
+	const ni, nj = 4, 3
+	be := binary.BigEndian
+
+	section := func(number uint8, body []byte) []byte {
+		s := be.AppendUint32(nil, uint32(5+len(body)))
+		s = append(s, number)
+		return append(s, body...)
+	}
+	microDegrees := func(v float64) uint32 {
+		if v < 0 {
+			return uint32(-v*1e6) | 0x80000000
+		}
+		return uint32(v * 1e6)
+	}
+
+	// section 1: centre 7, reference time 2024-01-02 00:00
+	s1 := section(1, []byte{0, 7, 0, 0, 2, 1, 1, 0x07, 0xe8, 1, 2, 0, 0, 0, 0, 1})
+
+	// section 3: template 3.0 grid, 3.1 adds rotation
+	template := uint16(0)
+	if rotation != nil {
+		template = 1
+	}
+	g := []byte{0}
+	g = be.AppendUint32(g, ni*nj)
+	g = append(g, 0, 0)
+	g = be.AppendUint16(g, template)
+	g = append(g, 6, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	g = be.AppendUint32(g, ni)
+	g = be.AppendUint32(g, nj)
+	g = append(g, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff)
+	g = be.AppendUint32(g, microDegrees(10))
+	g = be.AppendUint32(g, microDegrees(20))
+	g = append(g, 0x30)
+	g = be.AppendUint32(g, microDegrees(8))
+	g = be.AppendUint32(g, microDegrees(23))
+	g = be.AppendUint32(g, microDegrees(1))
+	g = be.AppendUint32(g, microDegrees(1))
+	g = append(g, 0)
+	if rotation != nil {
+		g = be.AppendUint32(g, microDegrees(rotation[0]))
+		g = be.AppendUint32(g, microDegrees(rotation[1]))
+		g = be.AppendUint32(g, math.Float32bits(float32(rotation[2])))
+	}
+	s3 := section(3, g)
+
+	// section 4: template 4.0 TMP at surface, analysis
+	s4 := section(4, []byte{0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 255, 0, 0, 0, 0, 0})
+
+	// section 5: template 5.0, reference 0, scales 0, 8 bits per value
+	d := be.AppendUint32(nil, ni*nj)
+	d = append(d, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 8, 0)
+	s5 := section(5, d)
+
+	s6 := section(6, []byte{255})
+
+	values := make([]byte, ni*nj)
+	for n := range values {
+		values[n] = byte(n)
+	}
+	s7 := section(7, values)
+
+	body := bytes.Join([][]byte{s1, s3, s4, s5, s6, s7, []byte("7777")}, nil)
+	msg := []byte{'G', 'R', 'I', 'B', 0, 0, 0, 2}
+	msg = be.AppendUint64(msg, uint64(16+len(body)))
+	return append(msg, body...)
+}
+
+func TestReadFields(t *testing.T) {
+	rotation := []float64{-30, 15, 0}
+	stream := bytes.Join([][]byte{rawMessage(nil), rawMessage(rotation), rawMessage(nil)}, nil)
+
+	fields, err := ReadFields(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 3 {
+		t.Fatalf("%d fields, want 3", len(fields))
+	}
+
+	for n, f := range fields {
+		if f.Ni != 4 || f.Nj != 3 {
+			t.Errorf("field %d is %dx%d, want 4x3", n, f.Ni, f.Nj)
+		}
+		for k, v := range f.Data {
+			if v != float32(k) {
+				t.Errorf("field %d value %d is %v, want %d", n, k, v, k)
+				break
+			}
+		}
+	}
+
+	regular := fields[0]
+	if regular.Projected() || regular.Lat0 != 10 || regular.Lng0 != 20 || regular.DLat != -1 || regular.DLng != 1 {
+		t.Errorf("regular field %+v", regular)
+	}
+
+	rotated := fields[1]
+	want := RotatedLatLng{Lat0: 10, Lng0: 20, DLat: -1, DLng: 1, SouthPoleLat: -30, SouthPoleLng: 15}
+	if rotated.Proj != want {
+		t.Fatalf("projection %+v, want %+v", rotated.Proj, want)
+	}
+	if rotated.Aligned(regular) {
+		t.Error("rotated field is aligned with regular one")
+	}
+	// pole at 30N 195E: rotated point (10N, 20E) is far from (10N, 20E)
+	lat, lng := rotated.Coord(0)
+	if math.Abs(float64(lat)-10) < 1 && math.Abs(float64(lng)-20) < 1 {
+		t.Errorf("rotated point 0 at %v, %v is not moved", lat, lng)
+	}
+	// every point maps back to itself
+	for n := range rotated.Data {
+		k, ok := rotated.index(rotated.Coord(n))
+		if !ok || k != n {
+			t.Errorf("point %d maps back to %d, %v", n, k, ok)
+		}
+	}
+}
+
+func TestReadFieldsErrors(t *testing.T) {
+	msg := rawMessage([]float64{-30, 15, 0})
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"edition 1", append([]byte("GRIB\x00\x00\x00\x01"), msg[8:]...)},
+		{"truncated", msg[:len(msg)-10]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadFields(bytes.NewReader(tt.data)); !errors.Is(err, ErrMessage) {
+				t.Errorf("error %v, want ErrMessage", err)
+			}
+		})
+	}
+}
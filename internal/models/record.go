@@ -3,15 +3,15 @@ package models
 import "time"
 
 type Record struct {
-	DateTime    time.Time
-	Lat         float32
-	Lng         float32
-	IsGround    bool
-	Pressure    float32
-	Temperature float32
-	UWind       float32
-	VWind       float32
-	CRain       float32
-	RHUmidity   float32
-	Visibility  float32
+	// RunTime model run reference time
+	RunTime time.Time
+	// DateTime valid time
+	DateTime time.Time
+	Lat      float32
+	Lng      float32
+	IsGround bool
+	// Level isobaric level (hPa), 0 for surface and near-surface variables
+	Level int16
+	// Values raw GRIB values aligned with catalog variables, NaN is stored as NULL
+	Values []float32
 }
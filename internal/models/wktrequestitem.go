@@ -7,3 +7,11 @@ type WKTRequestItem struct {
 	To   *time.Time
 	WKT  string
 }
+
+// LevelFilter vertical levels of forecast query
+type LevelFilter struct {
+	// Level isobaric level (hPa). 0 means surface and near-surface variables
+	Level int
+	// Column every isobaric level, Level is ignored
+	Column bool
+}
@@ -0,0 +1,373 @@
+// Package region select grid cells inside a bounding box or polygon.
+//
+// Longitudes may be given in -180..180 or 0..360 frame; cells are matched
+// modulo 360, so regions crossing longitude 0 or 180 work in both frames.
+package region
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrParseRegion = errors.New("region: failed to parse region")
+)
+
+type Point struct {
+	Lng float64
+	Lat float64
+}
+
+// Region set of polygons (outer rings only, holes are ignored)
+type Region struct {
+	polygons [][]Point
+}
+
+// Parse read region from bounding box "minLng,minLat,maxLng,maxLat", WKT
+// (POLYGON, MULTIPOLYGON), GeoJSON or a file with one of them.
+// minLng > maxLng means the box crosses the antimeridian
+func Parse(s string) (*Region, error) {
+	s = strings.TrimSpace(s)
+
+	if st, err := os.Stat(s); err == nil && !st.IsDir() {
+		data, err := os.ReadFile(s)
+		if err != nil {
+			return nil, errors.Join(ErrParseRegion, err)
+		}
+		s = strings.TrimSpace(string(data))
+	}
+
+	var (
+		r   *Region
+		err error
+	)
+	switch {
+	case strings.HasPrefix(s, "{"):
+		r, err = parseGeoJSON([]byte(s))
+	case len(s) > 0 && (s[0] >= 'A' && s[0] <= 'Z' || s[0] >= 'a' && s[0] <= 'z'):
+		r, err = parseWKT(s)
+	default:
+		r, err = parseBBox(s)
+	}
+
+	if err != nil {
+		return nil, errors.Join(ErrParseRegion, err)
+	}
+	return r, nil
+}
+
+// NewBBox create rectangular region
+func NewBBox(minLng, minLat, maxLng, maxLat float64) *Region {
+	if maxLng < minLng {
+		maxLng += 360
+	}
+	return &Region{
+		polygons: [][]Point{{
+			{minLng, minLat},
+			{maxLng, minLat},
+			{maxLng, maxLat},
+			{minLng, maxLat},
+		}},
+	}
+}
+
+// NewPolygons create region from polygons outer rings
+func NewPolygons(polygons ...[]Point) (*Region, error) {
+	r := &Region{}
+	for _, p := range polygons {
+		if len(p) > 1 && p[0] == p[len(p)-1] {
+			p = p[:len(p)-1]
+		}
+		if len(p) < 3 {
+			return nil, fmt.Errorf("polygon must have 3 or more points, got %d", len(p))
+		}
+		r.polygons = append(r.polygons, unwrap(p))
+	}
+	if len(r.polygons) == 0 {
+		return nil, errors.New("empty region")
+	}
+	return r, nil
+}
+
+// unwrap shift longitudes so that no edge is longer than 180 degrees
+func unwrap(p []Point) []Point {
+	res := make([]Point, len(p))
+	res[0] = p[0]
+	for i := 1; i < len(p); i++ {
+		lng := p[i].Lng
+		for lng-res[i-1].Lng > 180 {
+			lng -= 360
+		}
+		for lng-res[i-1].Lng < -180 {
+			lng += 360
+		}
+		res[i] = Point{lng, p[i].Lat}
+	}
+	return res
+}
+
+func parseBBox(s string) (*Region, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox %q: expected minLng,minLat,maxLng,maxLat", s)
+	}
+
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bbox %q: %w", s, err)
+		}
+		v[i] = f
+	}
+
+	if v[1] > v[3] {
+		return nil, fmt.Errorf("bbox %q: minLat > maxLat", s)
+	}
+
+	return NewBBox(v[0], v[1], v[2], v[3]), nil
+}
+
+func parseWKT(s string) (*Region, error) {
+	upper := strings.ToUpper(s)
+	var body string
+	switch {
+	case strings.HasPrefix(upper, "MULTIPOLYGON"):
+		body = s[len("MULTIPOLYGON"):]
+	case strings.HasPrefix(upper, "POLYGON"):
+		body = "(" + s[len("POLYGON"):] + ")"
+	default:
+		return nil, fmt.Errorf("unsupported WKT geometry: %.20q", s)
+	}
+
+	// body: ( ( (x y, ...), (hole) ), ( (x y, ...) ) )
+	var polygons [][]Point
+	depth := 0
+	ringStart := -1
+	ringIndex := 0
+	for i, c := range body {
+		switch c {
+		case '(':
+			depth++
+			if depth == 2 {
+				ringIndex = 0
+			}
+			if depth == 3 {
+				ringStart = i + 1
+			}
+		case ')':
+			if depth == 3 {
+				if ringIndex == 0 {
+					ring, err := parseWKTRing(body[ringStart:i])
+					if err != nil {
+						return nil, err
+					}
+					polygons = append(polygons, ring)
+				}
+				ringIndex++
+			}
+			depth--
+		}
+	}
+
+	if depth != 0 {
+		return nil, errors.New("unbalanced parentheses in WKT")
+	}
+
+	return NewPolygons(polygons...)
+}
+
+func parseWKTRing(s string) ([]Point, error) {
+	coords := strings.Split(s, ",")
+	ring := make([]Point, 0, len(coords))
+	for _, c := range coords {
+		f := strings.Fields(c)
+		if len(f) < 2 {
+			return nil, fmt.Errorf("bad WKT point %q", c)
+		}
+		lng, err := strconv.ParseFloat(f[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		lat, err := strconv.ParseFloat(f[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		ring = append(ring, Point{lng, lat})
+	}
+	return ring, nil
+}
+
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    *geoJSON        `json:"geometry"`
+	Features    []geoJSON       `json:"features"`
+}
+
+func parseGeoJSON(data []byte) (*Region, error) {
+	var g geoJSON
+	err := json.Unmarshal(data, &g)
+	if err != nil {
+		return nil, err
+	}
+
+	polygons, err := g.polygons()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPolygons(polygons...)
+}
+
+func (g *geoJSON) polygons() ([][]Point, error) {
+	switch g.Type {
+	case "FeatureCollection":
+		var res [][]Point
+		for _, f := range g.Features {
+			p, err := f.polygons()
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, p...)
+		}
+		return res, nil
+	case "Feature":
+		if g.Geometry == nil {
+			return nil, errors.New("feature without geometry")
+		}
+		return g.Geometry.polygons()
+	case "Polygon":
+		var rings [][][2]float64
+		if err := json.Unmarshal(g.Coordinates, &rings); err != nil {
+			return nil, err
+		}
+		if len(rings) == 0 {
+			return nil, errors.New("empty polygon")
+		}
+		return [][]Point{toPoints(rings[0])}, nil
+	case "MultiPolygon":
+		var polys [][][][2]float64
+		if err := json.Unmarshal(g.Coordinates, &polys); err != nil {
+			return nil, err
+		}
+		res := make([][]Point, 0, len(polys))
+		for _, rings := range polys {
+			if len(rings) > 0 {
+				res = append(res, toPoints(rings[0]))
+			}
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("unsupported GeoJSON type %q", g.Type)
+	}
+}
+
+func toPoints(coords [][2]float64) []Point {
+	res := make([]Point, len(coords))
+	for i, c := range coords {
+		res[i] = Point{c[0], c[1]}
+	}
+	return res
+}
+
+// BBox return bounding box of region. minLng may be negative and maxLng may
+// exceed 180 for regions crossing the antimeridian
+func (r *Region) BBox() (minLng, minLat, maxLng, maxLat float64) {
+	minLng, minLat, maxLng, maxLat = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range r.polygons {
+		for _, pt := range p {
+			minLng, maxLng = math.Min(minLng, pt.Lng), math.Max(maxLng, pt.Lng)
+			minLat, maxLat = math.Min(minLat, pt.Lat), math.Max(maxLat, pt.Lat)
+		}
+	}
+	return minLng, minLat, maxLng, maxLat
+}
+
+// IntersectsCell check the cell centered at lat, lng with side size (degrees)
+// intersects region
+func (r *Region) IntersectsCell(lat, lng, size float64) bool {
+	h := size / 2
+	for _, shift := range []float64{0, -360, 360, -720, 720} {
+		x := lng + shift
+		cell := [4]float64{x - h, lat - h, x + h, lat + h}
+		for _, p := range r.polygons {
+			if polygonIntersectsRect(p, cell) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// polygonIntersectsRect rect: minX, minY, maxX, maxY
+func polygonIntersectsRect(p []Point, rect [4]float64) bool {
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, pt := range p {
+		minX, maxX = math.Min(minX, pt.Lng), math.Max(maxX, pt.Lng)
+		minY, maxY = math.Min(minY, pt.Lat), math.Max(maxY, pt.Lat)
+	}
+	if maxX < rect[0] || minX > rect[2] || maxY < rect[1] || minY > rect[3] {
+		return false
+	}
+
+	for _, pt := range p {
+		if pt.Lng >= rect[0] && pt.Lng <= rect[2] && pt.Lat >= rect[1] && pt.Lat <= rect[3] {
+			return true
+		}
+	}
+
+	corners := [4]Point{
+		{rect[0], rect[1]},
+		{rect[2], rect[1]},
+		{rect[2], rect[3]},
+		{rect[0], rect[3]},
+	}
+	for _, c := range corners {
+		if containsPoint(p, c) {
+			return true
+		}
+	}
+
+	for i := range p {
+		a, b := p[i], p[(i+1)%len(p)]
+		for k := range corners {
+			if segmentsIntersect(a, b, corners[k], corners[(k+1)%4]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// containsPoint ray casting test
+func containsPoint(p []Point, pt Point) bool {
+	inside := false
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		a, b := p[i], p[j]
+		if (a.Lat > pt.Lat) != (b.Lat > pt.Lat) &&
+			pt.Lng < (b.Lng-a.Lng)*(pt.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func orientation(a, b, c Point) float64 {
+	return (b.Lng-a.Lng)*(c.Lat-a.Lat) - (b.Lat-a.Lat)*(c.Lng-a.Lng)
+}
+
+func segmentsIntersect(p1, p2, q1, q2 Point) bool {
+	d1 := orientation(q1, q2, p1)
+	d2 := orientation(q1, q2, p2)
+	d3 := orientation(p1, p2, q1)
+	d4 := orientation(p1, p2, q2)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) &&
+		((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
@@ -0,0 +1,108 @@
+package region
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		bbox    [4]float64
+		wantErr bool
+	}{
+		{"bbox", "-15,35,90,75", [4]float64{-15, 35, 90, 75}, false},
+		{"bbox with spaces", " 10, -5 , 20 ,5 ", [4]float64{10, -5, 20, 5}, false},
+		{"bbox across antimeridian", "170,-50,-170,-30", [4]float64{170, -50, 190, -30}, false},
+		{"wkt polygon", "POLYGON((0 0, 10 0, 10 10, 0 10, 0 0))", [4]float64{0, 0, 10, 10}, false},
+		{"wkt polygon across antimeridian", "POLYGON((170 0, -170 0, -170 10, 170 10, 170 0))", [4]float64{170, 0, 190, 10}, false},
+		{"wkt multipolygon", "MULTIPOLYGON(((0 0, 1 0, 1 1, 0 0)), ((5 5, 6 5, 6 6, 5 5)))", [4]float64{0, 0, 6, 6}, false},
+		{"geojson polygon", `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,0]]]}`, [4]float64{0, 0, 10, 10}, false},
+		{"geojson feature", `{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[350,0],[10,0],[10,10],[350,0]]]}}`, [4]float64{350, 0, 370, 10}, false},
+		{"bbox minLat > maxLat", "0,10,10,0", [4]float64{}, true},
+		{"bbox of 3 numbers", "0,10,10", [4]float64{}, true},
+		{"bad number", "0,a,10,10", [4]float64{}, true},
+		{"polygon of 2 points", "POLYGON((0 0, 1 1, 0 0))", [4]float64{}, true},
+		{"bad geojson", `{"type":"Point","coordinates":[0,0]}`, [4]float64{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.s)
+			if tt.wantErr {
+				if !errors.Is(err, ErrParseRegion) {
+					t.Errorf("error %v, want ErrParseRegion", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			minLng, minLat, maxLng, maxLat := r.BBox()
+			if got := [4]float64{minLng, minLat, maxLng, maxLat}; got != tt.bbox {
+				t.Errorf("bbox %v, want %v", got, tt.bbox)
+			}
+		})
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "region.wkt")
+	if err := os.WriteFile(name, []byte("POLYGON((0 0, 10 0, 10 10, 0 0))\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Parse(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.IntersectsCell(2, 8, 0.5) {
+		t.Error("cell inside polygon of file is not matched")
+	}
+}
+
+func TestIntersectsCell(t *testing.T) {
+	// box 170E..170W crossing the antimeridian
+	box := NewBBox(170, -10, -170, 10)
+	// triangle around longitude 0 given in 0..360 frame
+	triangle, err := NewPolygons([]Point{{350, 0}, {10, 0}, {0, 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		region   *Region
+		lat, lng float64
+		size     float64
+		want     bool
+	}{
+		{"box east of antimeridian", box, 0, 175, 0.5, true},
+		{"box west of antimeridian", box, 0, -175, 0.5, true},
+		{"box west of antimeridian in 0..360", box, 0, 185, 0.5, true},
+		{"box on antimeridian", box, 5, 180, 0.5, true},
+		{"box on antimeridian in -180 frame", box, 5, -180, 0.5, true},
+		{"box outside", box, 0, 160, 0.5, false},
+		{"box outside west", box, 0, -160, 0.5, false},
+		{"box outside north", box, 20, 175, 0.5, false},
+		{"cell overlapping box edge", box, 10.2, 175, 0.5, true},
+		{"cell beyond box edge", box, 10.3, 175, 0.5, false},
+		{"triangle east of 0", triangle, 2, 5, 1, true},
+		{"triangle west of 0", triangle, 2, -5, 1, true},
+		{"triangle west of 0 in 0..360", triangle, 2, 355, 1, true},
+		{"triangle outside", triangle, 15, 8, 1, false},
+		{"triangle far", triangle, 2, 180, 1, false},
+		{"cell containing triangle", triangle, 10, 0, 40, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.region.IntersectsCell(tt.lat, tt.lng, tt.size); got != tt.want {
+				t.Errorf("IntersectsCell(%v, %v, %v) = %v, want %v", tt.lat, tt.lng, tt.size, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"gfsloader/utils/download"
+	"gfsloader/utils/noaa"
+)
+
+// HTTP source served over HTTP with NOMADS layout: NOMADS itself or an S3 bucket
+type HTTP struct {
+	BaseURL    string
+	Model      noaa.Model
+	GridSize   noaa.GridSize
+	Downloader *download.Downloader
+	list       lister
+}
+
+// NewNOMADS create source reading NOMADS (or a mirror with HTML directory listing)
+func NewNOMADS(baseURL string, gridSize noaa.GridSize, downloader *download.Downloader) *HTTP {
+	s := newHTTP(baseURL, gridSize, downloader)
+	s.list = s.listHTML
+	return s
+}
+
+func newHTTP(baseURL string, gridSize noaa.GridSize, downloader *download.Downloader) *HTTP {
+	return &HTTP{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Model:      noaa.ModelAtmo,
+		GridSize:   gridSize,
+		Downloader: downloader,
+	}
+}
+
+func (s *HTTP) Runs(ctx context.Context, since time.Time) ([]noaa.Run, error) {
+	return listRuns(ctx, s.list, since)
+}
+
+func (s *HTTP) HasIndex(ctx context.Context, run noaa.Run, forecastTime int) (bool, error) {
+	return s.Downloader.Exists(ctx, s.Location(run, forecastTime)+".idx")
+}
+
+func (s *HTTP) FetchIndex(ctx context.Context, run noaa.Run, forecastTime int, dest string) error {
+	return s.Downloader.Download(ctx, "Get index file", dest, s.Location(run, forecastTime)+".idx", 0, 0)
+}
+
+func (s *HTTP) Size(ctx context.Context, run noaa.Run, forecastTime int) (uint64, error) {
+	return s.Downloader.Size(ctx, s.Location(run, forecastTime))
+}
+
+func (s *HTTP) FetchRange(ctx context.Context, label string, run noaa.Run, forecastTime int, from, to uint64, dest string) error {
+	return s.Downloader.Download(ctx, label, dest, s.Location(run, forecastTime), from, to)
+}
+
+func (s *HTTP) Location(run noaa.Run, forecastTime int) string {
+	return run.URL(s.BaseURL, s.Model, forecastTime, s.GridSize)
+}
+
+var hrefRe = regexp.MustCompile(`href="([^"?/]+)/"`)
+
+// listHTML read subdirectories from HTML directory index
+func (s *HTTP) listHTML(ctx context.Context, dir, _ string) ([]string, error) {
+	url := s.BaseURL + "/"
+	if dir != "" {
+		url += dir + "/"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.Downloader.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %d : %s", download.ErrStatus, resp.StatusCode, url)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, m := range hrefRe.FindAllStringSubmatch(string(body), -1) {
+		names = append(names, m[1])
+	}
+	return names, nil
+}
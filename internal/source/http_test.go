@@ -0,0 +1,80 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"gfsloader/utils/download"
+	"gfsloader/utils/noaa"
+)
+
+// testDownloader downloader of test server without retry delays
+func testDownloader(client *http.Client) *download.Downloader {
+	d := download.New()
+	d.Client = client
+	d.MaxRetries = 0
+	d.ShowProgress = false
+	return d
+}
+
+func runsString(runs []noaa.Run) []string {
+	res := make([]string, len(runs))
+	for n, r := range runs {
+		res[n] = r.String()
+	}
+	slices.Sort(res)
+	return res
+}
+
+func TestNOMADSRuns(t *testing.T) {
+	pages := map[string]string{
+		"/": `<a href="../">Parent</a>
+<a href="gfs.20240101/">gfs.20240101/</a>
+<a href="gfs.20240102/">gfs.20240102/</a>
+<a href="gfs.20240103/">gfs.20240103/</a>
+<a href="gdas.20240103/">gdas.20240103/</a>
+<a href="index.html?C=M">sort</a>`,
+		"/gfs.20240102/": `<a href="00/">00/</a> <a href="06/">06/</a> <a href="99/">99/</a>`,
+		"/gfs.20240103/": `<a href="00/">00/</a> <a href="info/">info/</a>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected listing of %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+	defer srv.Close()
+
+	src := NewNOMADS(srv.URL, noaa.GridSize0p25, testDownloader(srv.Client()))
+	runs, err := src.Runs(context.Background(), time.Date(2024, 1, 2, 5, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"20240102T00Z", "20240102T06Z", "20240103T00Z"}
+	if got := runsString(runs); !slices.Equal(got, want) {
+		t.Errorf("runs %v, want %v", got, want)
+	}
+}
+
+func TestNOMADSRunsStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	src := NewNOMADS(srv.URL, noaa.GridSize0p25, testDownloader(srv.Client()))
+	_, err := src.Runs(context.Background(), time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	if !errors.Is(err, ErrSource) || !errors.Is(err, download.ErrStatus) {
+		t.Errorf("error %v, want source status error", err)
+	}
+}
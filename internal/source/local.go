@@ -0,0 +1,159 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gfsloader/utils/indexfile"
+	"gfsloader/utils/noaa"
+)
+
+// Local directory of pre-downloaded files with NOMADS layout
+type Local struct {
+	Dir      string
+	Model    noaa.Model
+	GridSize noaa.GridSize
+}
+
+// NewLocal create source reading directory dir
+func NewLocal(dir string, gridSize noaa.GridSize) *Local {
+	return &Local{
+		Dir:      dir,
+		Model:    noaa.ModelAtmo,
+		GridSize: gridSize,
+	}
+}
+
+func (s *Local) Runs(ctx context.Context, since time.Time) ([]noaa.Run, error) {
+	return listRuns(ctx, s.list, since)
+}
+
+func (s *Local) list(_ context.Context, dir, _ string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, dir))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// HasIndex check .idx file or GRIB file it can be generated from exists
+func (s *Local) HasIndex(_ context.Context, run noaa.Run, forecastTime int) (bool, error) {
+	for _, name := range []string{s.Location(run, forecastTime) + ".idx", s.Location(run, forecastTime)} {
+		_, err := os.Stat(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return false, errors.Join(ErrSource, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// FetchIndex copy .idx file, generate it from GRIB file when it is missing
+func (s *Local) FetchIndex(_ context.Context, run noaa.Run, forecastTime int, dest string) error {
+	location := s.Location(run, forecastTime)
+	if _, err := os.Stat(location + ".idx"); errors.Is(err, os.ErrNotExist) {
+		return generateIndex(location, dest)
+	}
+	return copyRange(location+".idx", dest, 0, 0)
+}
+
+// generateIndex write inventory of GRIB file src to dest
+func generateIndex(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.Join(ErrSource, err)
+	}
+	defer in.Close()
+
+	idx, err := indexfile.Generate(in)
+	if err != nil {
+		return errors.Join(ErrSource, fmt.Errorf("%s: %w", src, err))
+	}
+
+	tmp := dest + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return errors.Join(ErrSource, err)
+	}
+
+	err = errors.Join(idx.Write(out), out.Close())
+	if err != nil {
+		os.Remove(tmp)
+		return errors.Join(ErrSource, err)
+	}
+
+	err = os.Rename(tmp, dest)
+	if err != nil {
+		return errors.Join(ErrSource, err)
+	}
+	return nil
+}
+
+func (s *Local) Size(_ context.Context, run noaa.Run, forecastTime int) (uint64, error) {
+	st, err := os.Stat(s.Location(run, forecastTime))
+	if err != nil {
+		return 0, errors.Join(ErrSource, err)
+	}
+	return uint64(st.Size()), nil
+}
+
+func (s *Local) FetchRange(_ context.Context, _ string, run noaa.Run, forecastTime int, from, to uint64, dest string) error {
+	return copyRange(s.Location(run, forecastTime), dest, from, to)
+}
+
+func (s *Local) Location(run noaa.Run, forecastTime int) string {
+	return filepath.FromSlash(run.URL(s.Dir, s.Model, forecastTime, s.GridSize))
+}
+
+// copyRange copy bytes from..to (inclusive, to == 0 up to the end) of src to dest
+func copyRange(src, dest string, from, to uint64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.Join(ErrSource, err)
+	}
+	defer in.Close()
+
+	var r io.Reader = io.NewSectionReader(in, int64(from), 1<<62)
+	if to != 0 {
+		r = io.NewSectionReader(in, int64(from), int64(to-from+1))
+	}
+
+	tmp := dest + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return errors.Join(ErrSource, err)
+	}
+
+	n, err := io.Copy(out, r)
+	closeErr := out.Close()
+	if err = errors.Join(err, closeErr); err != nil {
+		os.Remove(tmp)
+		return errors.Join(ErrSource, err)
+	}
+
+	if to != 0 && n != int64(to-from+1) {
+		os.Remove(tmp)
+		return errors.Join(ErrSource, fmt.Errorf("%s: got %d bytes, expected %d", src, n, to-from+1))
+	}
+
+	err = os.Rename(tmp, dest)
+	if err != nil {
+		return errors.Join(ErrSource, err)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package source
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gfsloader/utils/indexfile"
+	"gfsloader/utils/noaa"
+)
+
+// gribMessage GRIB2 message of meteorological parameter category:number at
+// surface with sections 0, 1 and 4 only, enough to be listed by indexfile.Generate
+func gribMessage(date time.Time, category, number uint8, forecast uint32) []byte {
+	section1 := make([]byte, 21)
+	binary.BigEndian.PutUint32(section1, 21)
+	section1[4] = 1
+	section1[9] = 2
+	binary.BigEndian.PutUint16(section1[12:], uint16(date.Year()))
+	section1[14], section1[15], section1[16] = byte(date.Month()), byte(date.Day()), byte(date.Hour())
+
+	section4 := make([]byte, 34)
+	binary.BigEndian.PutUint32(section4, 34)
+	section4[4] = 4
+	section4[9], section4[10] = category, number
+	section4[17] = 1 // hours
+	binary.BigEndian.PutUint32(section4[18:], forecast)
+	section4[22] = 1 // surface
+	copy(section4[28:], []byte{255, 255, 255, 255, 255, 255})
+
+	length := 16 + len(section1) + len(section4) + 4
+	msg := make([]byte, 0, length)
+	msg = append(msg, 'G', 'R', 'I', 'B', 0, 0, 0, 2)
+	msg = binary.BigEndian.AppendUint64(msg, uint64(length))
+	msg = append(msg, section1...)
+	msg = append(msg, section4...)
+	return append(msg, '7', '7', '7', '7')
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalRuns(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"gfs.20240101/00", "gfs.20240102/06", "gfs.20240102/12", "gfs.20240102/misc", "gdas.20240102/00", "gfs.20240103/18"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// files are not runs
+	writeFile(t, filepath.Join(dir, "gfs.20240103", "00"), nil)
+
+	src := NewLocal(dir, noaa.GridSize0p25)
+	runs, err := src.Runs(context.Background(), time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"20240102T06Z", "20240102T12Z", "20240103T18Z"}
+	if got := runsString(runs); !slices.Equal(got, want) {
+		t.Errorf("runs %v, want %v", got, want)
+	}
+
+	if _, err := NewLocal(filepath.Join(dir, "missing"), noaa.GridSize0p25).Runs(context.Background(), time.Time{}); !errors.Is(err, ErrSource) {
+		t.Errorf("error %v, want ErrSource", err)
+	}
+}
+
+func TestLocalFetchRange(t *testing.T) {
+	src := NewLocal(t.TempDir(), noaa.GridSize0p25)
+	run := noaa.Run{Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Cycle: noaa.ModelCycle12}
+	writeFile(t, src.Location(run, 6), []byte("0123456789"))
+
+	tests := []struct {
+		name     string
+		from, to uint64
+		want     string
+		wantErr  bool
+	}{
+		{"range", 2, 5, "2345", false},
+		{"to the end", 7, 0, "789", false},
+		{"whole file", 0, 0, "0123456789", false},
+		{"beyond the end", 8, 12, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "part")
+			err := src.FetchRange(context.Background(), "", run, 6, tt.from, tt.to, dest)
+			if tt.wantErr {
+				if !errors.Is(err, ErrSource) {
+					t.Errorf("error %v, want ErrSource", err)
+				}
+				if _, err := os.Stat(dest + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("temporary file is left: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b, _ := os.ReadFile(dest); string(b) != tt.want {
+				t.Errorf("got %q, want %q", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalSize(t *testing.T) {
+	src := NewLocal(t.TempDir(), noaa.GridSize0p25)
+	run := noaa.Run{Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Cycle: noaa.ModelCycle12}
+	writeFile(t, src.Location(run, 6), []byte("0123456789"))
+
+	if size, err := src.Size(context.Background(), run, 6); err != nil || size != 10 {
+		t.Errorf("Size = %d, %v, want 10", size, err)
+	}
+	if _, err := src.Size(context.Background(), run, 9); !errors.Is(err, ErrSource) {
+		t.Errorf("error %v of missing file, want ErrSource", err)
+	}
+}
+
+func TestLocalIndex(t *testing.T) {
+	ctx := context.Background()
+	src := NewLocal(t.TempDir(), noaa.GridSize0p25)
+	run := noaa.Run{Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Cycle: noaa.ModelCycle06}
+
+	if ok, err := src.HasIndex(ctx, run, 3); err != nil || ok {
+		t.Errorf("HasIndex of missing files %v, %v, want false", ok, err)
+	}
+
+	// hour 3 has only GRIB file, hour 6 has a sidecar
+	var grib []byte
+	grib = append(grib, gribMessage(run.Time(), 0, 0, 3)...)
+	grib = append(grib, gribMessage(run.Time(), 1, 192, 3)...)
+	writeFile(t, src.Location(run, 3), grib)
+	sidecar := "1:0:d=2024010206:TMP:2 m above ground:6 hour fcst:\n"
+	writeFile(t, src.Location(run, 6)+".idx", []byte(sidecar))
+
+	for _, hour := range []int{3, 6} {
+		if ok, err := src.HasIndex(ctx, run, hour); err != nil || !ok {
+			t.Errorf("HasIndex of hour %d %v, %v, want true", hour, ok, err)
+		}
+	}
+
+	dest := filepath.Join(t.TempDir(), "f003.idx")
+	if err := src.FetchIndex(ctx, run, 3, dest); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "1:0:d=2024010206:TMP:surface:3 hour fcst:\n2:75:d=2024010206:CRAIN:surface:3 hour fcst:\n"
+	if string(b) != want {
+		t.Errorf("generated index\n%s\nwant\n%s", b, want)
+	}
+	if _, err := indexfile.Parse(strings.NewReader(string(b)), uint64(len(grib))); err != nil {
+		t.Errorf("generated index is not parsed: %v", err)
+	}
+
+	dest = filepath.Join(t.TempDir(), "f006.idx")
+	if err := src.FetchIndex(ctx, run, 6, dest); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(dest); string(b) != sidecar {
+		t.Errorf("copied index %q, want %q", b, sidecar)
+	}
+
+	// GRIB file that is not GRIB2
+	writeFile(t, src.Location(run, 9), []byte("GRIB\x00\x00\x00\x01garbage"))
+	if err := src.FetchIndex(ctx, run, 9, filepath.Join(t.TempDir(), "f009.idx")); !errors.Is(err, indexfile.ErrScanGRIB) {
+		t.Errorf("error %v, want ErrScanGRIB", err)
+	}
+}
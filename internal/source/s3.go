@@ -0,0 +1,219 @@
+package source
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"gfsloader/utils/download"
+	"gfsloader/utils/noaa"
+)
+
+const (
+	// DefaultS3Endpoint AWS S3 endpoint
+	DefaultS3Endpoint = "https://s3.amazonaws.com"
+	// DefaultS3Bucket NOAA open data GFS mirror
+	DefaultS3Bucket = "noaa-gfs-bdp-pds"
+	DefaultS3Region = "us-east-1"
+
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// S3Config S3-compatible bucket (AWS, MinIO) addressed path-style: Endpoint/Bucket/Prefix
+type S3Config struct {
+	Endpoint string
+	Bucket   string
+	// Prefix key prefix of gfs.YYYYMMDD directories, may be empty
+	Prefix string
+	Region string
+	// AccessKey, SecretKey credentials. Requests are anonymous if AccessKey is empty
+	AccessKey string
+	SecretKey string
+}
+
+// NewS3 create source reading S3 bucket with NOMADS layout (e.g. NOAA open data mirror)
+func NewS3(cfg S3Config, gridSize noaa.GridSize, downloader *download.Downloader) *HTTP {
+	bucketURL := strings.TrimSuffix(cfg.Endpoint, "/") + "/" + cfg.Bucket
+
+	if cfg.AccessKey != "" {
+		client := *downloader.Client
+		client.Transport = &s3Signer{
+			next:      client.Transport,
+			region:    cfg.Region,
+			accessKey: cfg.AccessKey,
+			secretKey: cfg.SecretKey,
+		}
+		d := *downloader
+		d.Client = &client
+		downloader = &d
+	}
+
+	prefix := strings.Trim(cfg.Prefix, "/")
+	baseURL := bucketURL
+	if prefix != "" {
+		baseURL += "/" + prefix
+		prefix += "/"
+	}
+
+	s := newHTTP(baseURL, gridSize, downloader)
+	s.list = func(ctx context.Context, dir, startAfter string) ([]string, error) {
+		return listS3(ctx, downloader.Client, bucketURL, prefix, dir, startAfter)
+	}
+	return s
+}
+
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	CommonPrefixes        []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// listS3 read subdirectories with ListObjectsV2
+func listS3(ctx context.Context, client *http.Client, bucketURL, prefix, dir, startAfter string) ([]string, error) {
+	if dir != "" {
+		prefix += dir + "/"
+	}
+
+	var names []string
+	token := ""
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("delimiter", "/")
+		q.Set("prefix", prefix)
+		if startAfter != "" {
+			q.Set("start-after", prefix+startAfter)
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u := bucketURL + "?" + encodeQuery(q)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var result listBucketResult
+		if resp.StatusCode == http.StatusOK {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		} else {
+			err = fmt.Errorf("%w: %d : %s", download.ErrStatus, resp.StatusCode, u)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range result.CommonPrefixes {
+			names = append(names, strings.TrimSuffix(strings.TrimPrefix(p.Prefix, prefix), "/"))
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// encodeQuery encode query as AWS signature V4 canonical query string
+func encodeQuery(q url.Values) string {
+	return strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+// s3Signer sign requests with AWS signature V4, payload is not signed
+type s3Signer struct {
+	next      http.RoundTripper
+	region    string
+	accessKey string
+	secretKey string
+}
+
+func (s *s3Signer) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": unsignedPayload,
+		"x-amz-date":           amzDate,
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		encodeQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", day, s.region)
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature,
+	))
+
+	next := s.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
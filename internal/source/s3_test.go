@@ -0,0 +1,201 @@
+package source
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gfsloader/utils/noaa"
+)
+
+// listPage ListObjectsV2 response with common prefixes
+func listPage(prefixes []string, next string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><ListBucketResult>`)
+	fmt.Fprintf(&b, "<IsTruncated>%t</IsTruncated>", next != "")
+	if next != "" {
+		fmt.Fprintf(&b, "<NextContinuationToken>%s</NextContinuationToken>", next)
+	}
+	for _, p := range prefixes {
+		fmt.Fprintf(&b, "<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", p)
+	}
+	b.WriteString("</ListBucketResult>")
+	return b.String()
+}
+
+func TestS3Runs(t *testing.T) {
+	type page struct {
+		prefixes []string
+		next     string
+	}
+	// pages by prefix and continuation token
+	pages := map[[2]string]page{
+		{"mirror/", ""}:                {[]string{"mirror/gfs.20240102/"}, "t1"},
+		{"mirror/", "t1"}:              {[]string{"mirror/gfs.20240103/", "mirror/gdas.20240103/"}, "t2"},
+		{"mirror/", "t2"}:              {[]string{"mirror/gfs.20240104/"}, ""},
+		{"mirror/gfs.20240102/", ""}:   {[]string{"mirror/gfs.20240102/12/"}, ""},
+		{"mirror/gfs.20240103/", ""}:   {[]string{"mirror/gfs.20240103/00/"}, "t3"},
+		{"mirror/gfs.20240103/", "t3"}: {[]string{"mirror/gfs.20240103/18/"}, ""},
+		{"mirror/gfs.20240104/", ""}:   {nil, ""},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket" {
+			t.Errorf("path %s, want /bucket", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("list-type") != "2" || q.Get("delimiter") != "/" {
+			t.Errorf("query %s is not ListObjectsV2 with delimiter", r.URL.RawQuery)
+		}
+
+		prefix, token := q.Get("prefix"), q.Get("continuation-token")
+		if prefix == "mirror/" && token == "" && q.Get("start-after") != "mirror/gfs.20240101" {
+			t.Errorf("start-after %q, want mirror/gfs.20240101", q.Get("start-after"))
+		}
+		p, ok := pages[[2]string{prefix, token}]
+		if !ok {
+			t.Errorf("unexpected page %q %q", prefix, token)
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, listPage(p.prefixes, p.next))
+	}))
+	defer srv.Close()
+
+	cfg := S3Config{Endpoint: srv.URL + "/", Bucket: "bucket", Prefix: "/mirror/", Region: DefaultS3Region}
+	src := NewS3(cfg, noaa.GridSize0p25, testDownloader(srv.Client()))
+	if want := srv.URL + "/bucket/mirror"; src.BaseURL != want {
+		t.Errorf("base URL %s, want %s", src.BaseURL, want)
+	}
+
+	runs, err := src.Runs(context.Background(), time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"20240102T12Z", "20240103T00Z", "20240103T18Z"}
+	if got := runsString(runs); !slices.Equal(got, want) {
+		t.Errorf("runs %v, want %v", got, want)
+	}
+}
+
+// verifySigV4 recompute AWS signature V4 of request received by server
+func verifySigV4(r *http.Request, region, accessKey, secretKey string) error {
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) != len("20060102T150405Z") {
+		return fmt.Errorf("bad X-Amz-Date %q", amzDate)
+	}
+	day := amzDate[:8]
+	if h := r.Header.Get("X-Amz-Content-Sha256"); h != unsignedPayload {
+		return fmt.Errorf("X-Amz-Content-Sha256 %q, want %s", h, unsignedPayload)
+	}
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		strings.ReplaceAll(r.URL.Query().Encode(), "+", "%20"),
+		"host:" + r.Host + "\nx-amz-content-sha256:" + unsignedPayload + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := day + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{day, region, "s3", "aws4_request", stringToSign} {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(part))
+		key = h.Sum(nil)
+	}
+
+	want := fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, hex.EncodeToString(key))
+	if got := r.Header.Get("Authorization"); got != want {
+		return fmt.Errorf("authorization %q, want %q", got, want)
+	}
+	return nil
+}
+
+func TestS3Signer(t *testing.T) {
+	tests := []struct {
+		name      string
+		accessKey string
+		secretKey string
+		signed    bool
+	}{
+		{"anonymous", "", "", false},
+		{"signed", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if !tt.signed {
+					if auth := r.Header.Get("Authorization"); auth != "" {
+						t.Errorf("anonymous request has authorization %q", auth)
+					}
+				} else if err := verifySigV4(r, "eu-west-1", tt.accessKey, tt.secretKey); err != nil {
+					t.Errorf("%s %s: %v", r.Method, r.URL, err)
+				}
+
+				if r.URL.Query().Has("list-type") {
+					fmt.Fprint(w, listPage(nil, ""))
+					return
+				}
+				http.ServeContent(w, r, "", time.Time{}, strings.NewReader("0123456789"))
+			}))
+			defer srv.Close()
+
+			cfg := S3Config{
+				Endpoint:  srv.URL,
+				Bucket:    "bucket",
+				Prefix:    "with space",
+				Region:    "eu-west-1",
+				AccessKey: tt.accessKey,
+				SecretKey: tt.secretKey,
+			}
+			src := NewS3(cfg, noaa.GridSize0p25, testDownloader(srv.Client()))
+			run := noaa.Run{Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Cycle: noaa.ModelCycle06}
+
+			ctx := context.Background()
+			if _, err := src.Runs(ctx, run.Date); err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := src.HasIndex(ctx, run, 3); err != nil || !ok {
+				t.Errorf("HasIndex %v, %v, want true", ok, err)
+			}
+			dest := t.TempDir() + "/range"
+			if err := src.FetchRange(ctx, "", run, 3, 2, 5, dest); err != nil {
+				t.Error(err)
+			} else if b, _ := os.ReadFile(dest); string(b) != "2345" {
+				t.Errorf("range %q, want 2345", b)
+			}
+			if requests != 3 {
+				t.Errorf("%d requests, want 3", requests)
+			}
+		})
+	}
+}
+
+func TestEncodeQuery(t *testing.T) {
+	q := url.Values{}
+	q.Set("prefix", "a b/c+d")
+	q.Set("list-type", "2")
+	if got, want := encodeQuery(q), "list-type=2&prefix=a%20b%2Fc%2Bd"; got != want {
+		t.Errorf("encodeQuery %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,127 @@
+// Package source fetch GFS files from NOMADS, an S3-compatible mirror or a
+// local directory. Every source uses the NOMADS layout:
+// gfs.YYYYMMDD/HH/atmos/gfs.tHHz.pgrb2.0p25.fFFF (+ .idx)
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gfsloader/utils/noaa"
+)
+
+var (
+	ErrSource = errors.New("source error")
+)
+
+// Source GFS files storage
+type Source interface {
+	// Runs list runs with date not before since (published runs may be incomplete)
+	Runs(ctx context.Context, since time.Time) ([]noaa.Run, error)
+	// HasIndex check .idx file of forecast hour is published
+	HasIndex(ctx context.Context, run noaa.Run, forecastTime int) (bool, error)
+	// FetchIndex save .idx file of forecast hour to dest
+	FetchIndex(ctx context.Context, run noaa.Run, forecastTime int, dest string) error
+	// Size return length of GRIB file of forecast hour, 0 when it is unknown
+	Size(ctx context.Context, run noaa.Run, forecastTime int) (uint64, error)
+	// FetchRange save bytes from..to (inclusive) of GRIB file to dest. to == 0 means up to the end of file
+	FetchRange(ctx context.Context, label string, run noaa.Run, forecastTime int, from, to uint64, dest string) error
+	// Location return GRIB file URL or path, index file is Location + ".idx"
+	Location(run noaa.Run, forecastTime int) string
+}
+
+// Latest return the newest run with every forecast hour published.
+// lookback limits number of checked runs
+func Latest(ctx context.Context, src Source, hours []int, now time.Time, lookback int) (noaa.Run, error) {
+	since := noaa.NewRun(now).Time().Add(-time.Duration(lookback) * 6 * time.Hour)
+	runs, err := src.Runs(ctx, since)
+	if err != nil {
+		return noaa.Run{}, err
+	}
+
+	slices.SortFunc(runs, func(a, b noaa.Run) int {
+		return b.Time().Compare(a.Time())
+	})
+
+	checked := 0
+	for _, run := range runs {
+		if run.Time().After(now) || checked >= lookback {
+			continue
+		}
+		checked++
+
+		complete, err := isComplete(ctx, src, run, hours)
+		if err != nil {
+			return noaa.Run{}, err
+		}
+		if complete {
+			return run, nil
+		}
+	}
+
+	return noaa.Run{}, fmt.Errorf("%w: since %s", noaa.ErrRunNotFound, noaa.NewRun(since))
+}
+
+func isComplete(ctx context.Context, src Source, run noaa.Run, hours []int) (bool, error) {
+	for _, hour := range hours {
+		ok, err := src.HasIndex(ctx, run, hour)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// lister return names of subdirectories of dir ("" is the root). Names
+// before startAfter may be skipped
+type lister func(ctx context.Context, dir, startAfter string) ([]string, error)
+
+var (
+	dateDirRe  = regexp.MustCompile(`^gfs\.(\d{8})$`)
+	cycleDirRe = regexp.MustCompile(`^\d{2}$`)
+)
+
+// listRuns walk gfs.YYYYMMDD/HH directories
+func listRuns(ctx context.Context, list lister, since time.Time) ([]noaa.Run, error) {
+	since = since.UTC().Truncate(24 * time.Hour)
+	startAfter := "gfs." + since.Add(-24*time.Hour).Format("20060102")
+
+	days, err := list(ctx, "", startAfter)
+	if err != nil {
+		return nil, errors.Join(ErrSource, err)
+	}
+
+	var runs []noaa.Run
+	for _, day := range days {
+		m := dateDirRe.FindStringSubmatch(strings.TrimSuffix(day, "/"))
+		if m == nil {
+			continue
+		}
+		date, err := time.Parse("20060102", m[1])
+		if err != nil || date.Before(since) {
+			continue
+		}
+
+		cycles, err := list(ctx, m[0], "")
+		if err != nil {
+			return nil, errors.Join(ErrSource, err)
+		}
+		for _, c := range cycles {
+			c = strings.TrimSuffix(c, "/")
+			if !cycleDirRe.MatchString(c) {
+				continue
+			}
+			cycle, err := noaa.ParseModelCycle(c)
+			if err != nil {
+				continue
+			}
+			runs = append(runs, noaa.Run{Date: date, Cycle: cycle})
+		}
+	}
+	return runs, nil
+}
@@ -0,0 +1,206 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gfsloader/utils/download"
+	"gfsloader/utils/noaa"
+)
+
+// nomadsServer NOMADS stand-in listing runs of published .idx files. HEAD of
+// path is answered with status codes queued for it, then 200 if it is
+// published or 404
+type nomadsServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	published map[string]bool
+	status    map[string][]int
+	heads     map[string]int
+}
+
+func newNOMADSServer(published ...string) *nomadsServer {
+	s := &nomadsServer{
+		published: make(map[string]bool),
+		status:    make(map[string][]int),
+		heads:     make(map[string]int),
+	}
+	for _, p := range published {
+		s.published["/"+p] = true
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *nomadsServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == http.MethodHead {
+		s.heads[r.URL.Path]++
+		if codes := s.status[r.URL.Path]; len(codes) > 0 {
+			s.status[r.URL.Path] = codes[1:]
+			w.WriteHeader(codes[0])
+			return
+		}
+		if !s.published[r.URL.Path] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+
+	// directory listing of published files
+	dir := strings.TrimPrefix(r.URL.Path, "/")
+	seen := make(map[string]bool)
+	for p := range s.published {
+		rest, ok := strings.CutPrefix(strings.TrimPrefix(p, "/"), dir)
+		if !ok {
+			continue
+		}
+		if name, _, ok := strings.Cut(rest, "/"); ok && !seen[name] {
+			seen[name] = true
+			fmt.Fprintf(w, "<a href=\"%s/\">%s/</a>\n", name, name)
+		}
+	}
+}
+
+func (s *nomadsServer) headCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.heads["/"+path]
+}
+
+func idxPath(day, cycle string, hour int) string {
+	return fmt.Sprintf("gfs.%s/%s/atmos/gfs.t%sz.pgrb2.0p25.f%03d.idx", day, cycle, cycle, hour)
+}
+
+func TestLatest(t *testing.T) {
+	now := time.Date(2024, 1, 3, 7, 30, 0, 0, time.UTC)
+	hours := []int{0, 3}
+
+	tests := []struct {
+		name      string
+		published []string
+		lookback  int
+		want      string
+	}{
+		{
+			name:      "newest run is complete",
+			published: []string{idxPath("20240103", "06", 0), idxPath("20240103", "06", 3), idxPath("20240103", "00", 0), idxPath("20240103", "00", 3)},
+			lookback:  4,
+			want:      "20240103T06Z",
+		},
+		{
+			name:      "newest run is incomplete",
+			published: []string{idxPath("20240103", "06", 0), idxPath("20240103", "00", 0), idxPath("20240103", "00", 3)},
+			lookback:  4,
+			want:      "20240103T00Z",
+		},
+		{
+			name:      "runs of the future are skipped",
+			published: []string{idxPath("20240103", "12", 0), idxPath("20240103", "12", 3), idxPath("20240102", "18", 0), idxPath("20240102", "18", 3)},
+			lookback:  4,
+			want:      "20240102T18Z",
+		},
+		{
+			name:      "complete run beyond lookback",
+			published: []string{idxPath("20240103", "06", 0), idxPath("20240103", "00", 0), idxPath("20240102", "18", 0), idxPath("20240102", "12", 0), idxPath("20240102", "12", 3)},
+			lookback:  3,
+		},
+		{
+			name:     "nothing is published",
+			lookback: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newNOMADSServer(tt.published...)
+			defer srv.Close()
+
+			src := NewNOMADS(srv.URL, noaa.GridSize0p25, testDownloader(srv.Client()))
+			run, err := Latest(context.Background(), src, hours, now, tt.lookback)
+			if tt.want == "" {
+				if !errors.Is(err, noaa.ErrRunNotFound) {
+					t.Errorf("run %s, error %v, want ErrRunNotFound", run, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if run.String() != tt.want {
+				t.Errorf("run %s, want %s", run, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatestStatus(t *testing.T) {
+	now := time.Date(2024, 1, 3, 7, 30, 0, 0, time.UTC)
+	probed := idxPath("20240103", "06", 3)
+
+	tests := []struct {
+		name string
+		// status answers of probed .idx of the newest run before 200 (published) or 404
+		status    []int
+		published bool
+		// throttle server host answers 403 over request rate like NOMADS
+		throttle bool
+		want     string
+		wantErr  error
+		heads    int
+	}{
+		{"404 is not published", nil, false, true, "20240103T00Z", nil, 1},
+		{"NOMADS 403 is retried", []int{http.StatusForbidden, http.StatusForbidden}, true, true, "20240103T06Z", nil, 3},
+		{"NOMADS 403 after retries", []int{http.StatusForbidden, http.StatusForbidden, http.StatusForbidden}, true, true, "", download.ErrStatus, 3},
+		{"403 of other host is not retried", []int{http.StatusForbidden}, true, false, "", download.ErrStatus, 1},
+		{"500 is retried", []int{http.StatusInternalServerError}, true, false, "20240103T06Z", nil, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			published := []string{idxPath("20240103", "06", 0), idxPath("20240103", "00", 0), idxPath("20240103", "00", 3)}
+			if tt.published {
+				published = append(published, probed)
+			}
+			srv := newNOMADSServer(published...)
+			defer srv.Close()
+			srv.status["/"+probed] = tt.status
+
+			downloader := testDownloader(srv.Client())
+			downloader.MaxRetries = 2
+			downloader.MinBackoff = time.Millisecond
+			downloader.MaxBackoff = time.Millisecond
+			if tt.throttle {
+				host := strings.TrimPrefix(srv.URL, "http://")
+				downloader.ThrottlesForbidden = func(h string) bool { return h == host }
+			}
+
+			src := NewNOMADS(srv.URL, noaa.GridSize0p25, downloader)
+			run, err := Latest(context.Background(), src, []int{0, 3}, now, 4)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("run %s, error %v, want %v", run, err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case run.String() != tt.want:
+				t.Errorf("run %s, want %s", run, tt.want)
+			}
+
+			if got := srv.headCount(probed); got != tt.heads {
+				t.Errorf("%d requests of %s, want %d", got, probed, tt.heads)
+			}
+		})
+	}
+}
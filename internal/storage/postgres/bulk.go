@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	appModels "gfsloader/internal/models"
+	"gfsloader/internal/storage"
+	models "gfsloader/internal/storage/postgres/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	stageTable = "records_stage"
+)
+
+var (
+	ErrBulkNotSupported = errors.New("storage: bulk load requires pgx connection")
+)
+
+// RecordIterator return next record for CopyRecords, false at the end.
+// Returned record may be reused by the next call
+type RecordIterator func() (*appModels.Record, bool)
+
+// recordColumns columns written by CopyRecords
+func (d *PostgresDataProvider) recordColumns() []string {
+	columns := make([]string, 0, len(d.catalog.Variables)+6)
+	columns = append(columns, "grid_id", "run_time", "date_time", "lead_time", "is_ground", "level")
+	for _, v := range d.catalog.Variables {
+		columns = append(columns, v.Column)
+	}
+	return columns
+}
+
+func (d *PostgresDataProvider) createStageSQL() string {
+	columns := make([]string, 0, len(d.catalog.Variables)+6)
+	columns = append(columns, "grid_id int8", "run_time timestamptz", "date_time timestamptz", "lead_time int2", "is_ground boolean", "level int2")
+	for _, v := range d.catalog.Variables {
+		columns = append(columns, v.Column+" real")
+	}
+	return fmt.Sprintf("CREATE TEMP TABLE %s (%s) ON COMMIT DROP", stageTable, strings.Join(columns, ","))
+}
+
+func (d *PostgresDataProvider) mergeSQL() string {
+	columns := strings.Join(d.recordColumns(), ",")
+
+	updates := make([]string, 0, len(d.catalog.Variables)+1)
+	for _, c := range d.updateColumns() {
+		updates = append(updates, fmt.Sprintf("%[1]s=EXCLUDED.%[1]s", c))
+	}
+
+	return fmt.Sprintf(
+		"INSERT INTO %[1]s (%[2]s) SELECT %[2]s FROM %[3]s ON CONFLICT (%[5]s) DO UPDATE SET %[4]s",
+		models.PGRecord{}.TableName(),
+		columns,
+		stageTable,
+		strings.Join(updates, ","),
+		strings.Join(recordKey, ","),
+	)
+}
+
+// CopyRecords stream records into a staging table with COPY and merge them into
+// "records" with one INSERT ... ON CONFLICT, all in one transaction.
+// Use SetRecords for small writes. Return merged rows count
+func (d *PostgresDataProvider) CopyRecords(ctx context.Context, next RecordIterator) (int64, error) {
+	sqlDB, err := d.db.DB()
+	if err != nil {
+		return 0, errors.Join(storage.ErrDatabaseError, err)
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return 0, errors.Join(storage.ErrDatabaseError, err)
+	}
+	defer conn.Close()
+
+	var merged int64
+	err = conn.Raw(func(driverConn any) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return ErrBulkNotSupported
+		}
+
+		tx, err := stdConn.Conn().Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		_, err = tx.Exec(ctx, d.createStageSQL())
+		if err != nil {
+			return err
+		}
+
+		columns := d.recordColumns()
+		row := make([]any, len(columns))
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{stageTable}, columns, pgx.CopyFromFunc(func() ([]any, error) {
+			record, ok := next()
+			if !ok {
+				return nil, nil
+			}
+
+			row[0] = coordToIndex(record.Lat, record.Lng)
+			row[1] = record.RunTime
+			row[2] = record.DateTime
+			row[3] = leadTime(record)
+			row[4] = record.IsGround
+			row[5] = record.Level
+			for i := range d.catalog.Variables {
+				if i < len(record.Values) {
+					row[6+i] = nullable(record.Values[i])
+				} else {
+					row[6+i] = nil
+				}
+			}
+			return row, nil
+		}))
+		if err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, d.mergeSQL())
+		if err != nil {
+			return err
+		}
+		merged = tag.RowsAffected()
+
+		return tx.Commit(ctx)
+	})
+
+	if err != nil {
+		return 0, errors.Join(storage.ErrDatabaseError, err)
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gfsloader/internal/storage"
+	models "gfsloader/internal/storage/postgres/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StartRun register model run in ingest ledger. Complete run stays complete
+func (d *PostgresDataProvider) StartRun(ctx context.Context, runTime time.Time) error {
+	run := models.PGIngestRun{
+		RunTime:   runTime,
+		Status:    models.IngestStatusRunning,
+		StartedAt: time.Now(),
+	}
+
+	r := d.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "run_time"}},
+		DoUpdates: clause.Set{{
+			Column: clause.Column{Name: "status"},
+			Value: gorm.Expr(
+				"CASE WHEN ingest_runs.status = ? THEN ingest_runs.status ELSE ? END",
+				models.IngestStatusComplete,
+				models.IngestStatusRunning,
+			),
+		}},
+	}).Create(&run)
+
+	if r.Error != nil {
+		return errors.Join(storage.ErrDatabaseError, r.Error)
+	}
+	return nil
+}
+
+// FinishRun set model run status
+func (d *PostgresDataProvider) FinishRun(ctx context.Context, runTime time.Time, status string) error {
+	r := d.db.WithContext(ctx).Model(&models.PGIngestRun{}).
+		Where("run_time = ?", runTime).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"finished_at": time.Now(),
+		})
+
+	if r.Error != nil {
+		return errors.Join(storage.ErrDatabaseError, r.Error)
+	}
+	return nil
+}
+
+// StartStep mark forecast hour as running and count the attempt
+func (d *PostgresDataProvider) StartStep(ctx context.Context, runTime time.Time, forecastHour int, sourceURLs []string) error {
+	step := models.PGIngestStep{
+		RunTime:      runTime,
+		ForecastHour: forecastHour,
+		Status:       models.IngestStatusRunning,
+		Attempts:     1,
+		StartedAt:    time.Now(),
+		SourceURLs:   sourceURLs,
+	}
+
+	updates := clause.AssignmentColumns([]string{"status", "started_at", "finished_at", "source_urls", "error", "bytes", "rows"})
+	updates = append(updates, clause.Assignment{
+		Column: clause.Column{Name: "attempts"},
+		Value:  gorm.Expr("ingest_steps.attempts + 1"),
+	})
+
+	r := d.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "run_time"}, {Name: "forecast_hour"}},
+		DoUpdates: updates,
+	}).Create(&step)
+
+	if r.Error != nil {
+		return errors.Join(storage.ErrDatabaseError, r.Error)
+	}
+	return nil
+}
+
+// FinishStep mark forecast hour as complete
+func (d *PostgresDataProvider) FinishStep(ctx context.Context, runTime time.Time, forecastHour int, bytes, rows int64) error {
+	return d.updateStep(ctx, runTime, forecastHour, map[string]interface{}{
+		"status":      models.IngestStatusComplete,
+		"finished_at": time.Now(),
+		"bytes":       bytes,
+		"rows":        rows,
+		"error":       "",
+	})
+}
+
+// FailStep mark forecast hour as failed
+func (d *PostgresDataProvider) FailStep(ctx context.Context, runTime time.Time, forecastHour int, stepErr error) error {
+	return d.updateStep(ctx, runTime, forecastHour, map[string]interface{}{
+		"status":      models.IngestStatusFailed,
+		"finished_at": time.Now(),
+		"error":       stepErr.Error(),
+	})
+}
+
+func (d *PostgresDataProvider) updateStep(ctx context.Context, runTime time.Time, forecastHour int, values map[string]interface{}) error {
+	r := d.db.WithContext(ctx).Model(&models.PGIngestStep{}).
+		Where("run_time = ? AND forecast_hour = ?", runTime, forecastHour).
+		Updates(values)
+
+	if r.Error != nil {
+		return errors.Join(storage.ErrDatabaseError, r.Error)
+	}
+	return nil
+}
+
+// CompletedSteps return loaded forecast hours of run
+func (d *PostgresDataProvider) CompletedSteps(ctx context.Context, runTime time.Time) ([]int, error) {
+	var hours []int
+	r := d.db.WithContext(ctx).Model(&models.PGIngestStep{}).
+		Where("run_time = ? AND status = ?", runTime, models.IngestStatusComplete).
+		Order("forecast_hour").
+		Pluck("forecast_hour", &hours)
+
+	if r.Error != nil {
+		return nil, errors.Join(storage.ErrDatabaseError, r.Error)
+	}
+	return hours, nil
+}
+
+// LatestRun return the newest registered run
+func (d *PostgresDataProvider) LatestRun(ctx context.Context) (*models.PGIngestRun, error) {
+	var runs []models.PGIngestRun
+	r := d.db.WithContext(ctx).Order("run_time DESC").Limit(1).Find(&runs)
+
+	if r.Error != nil {
+		return nil, errors.Join(storage.ErrDatabaseError, r.Error)
+	}
+	if len(runs) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return &runs[0], nil
+}
+
+// LatestCompleteRun return reference time of the newest completely loaded run
+func (d *PostgresDataProvider) LatestCompleteRun(ctx context.Context) (time.Time, error) {
+	var runs []models.PGIngestRun
+	r := d.db.WithContext(ctx).Where("status = ?", models.IngestStatusComplete).Order("run_time DESC").Limit(1).Find(&runs)
+
+	if r.Error != nil {
+		return time.Time{}, errors.Join(storage.ErrDatabaseError, r.Error)
+	}
+	if len(runs) == 0 {
+		return time.Time{}, storage.ErrNotFound
+	}
+	return runs[0].RunTime, nil
+}
+
+// IngestSummary return newest runs with forecast hour counters
+func (d *PostgresDataProvider) IngestSummary(ctx context.Context, limit int) ([]models.PGIngestSummary, error) {
+	var result []models.PGIngestSummary
+	err := d.db.WithContext(ctx).Raw(
+		"SELECT r.*, "+
+			"COUNT(s.id) FILTER (WHERE s.status = ?) AS steps_complete, "+
+			"COUNT(s.id) FILTER (WHERE s.status = ?) AS steps_failed, "+
+			"COALESCE(SUM(s.rows) FILTER (WHERE s.status = ?), 0) AS rows "+
+			"FROM ingest_runs r LEFT JOIN ingest_steps s ON s.run_time = r.run_time "+
+			"GROUP BY r.id ORDER BY r.run_time DESC LIMIT ?",
+		models.IngestStatusComplete,
+		models.IngestStatusFailed,
+		models.IngestStatusComplete,
+		limit,
+	).Scan(&result).Error
+
+	if err != nil {
+		return nil, errors.Join(storage.ErrDatabaseError, err)
+	}
+	return result, nil
+}
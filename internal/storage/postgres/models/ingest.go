@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+const (
+	IngestStatusRunning  = "running"
+	IngestStatusComplete = "complete"
+	IngestStatusFailed   = "failed"
+)
+
+// PGIngestRun loaded model run
+type PGIngestRun struct {
+	ID         uint64    `gorm:"primaryKey;autoincrement;"`
+	RunTime    time.Time `gorm:"uniqueIndex"`
+	Status     string    `gorm:"type:varchar(16)"`
+	StartedAt  time.Time
+	FinishedAt *time.Time
+}
+
+func (PGIngestRun) TableName() string {
+	return "ingest_runs"
+}
+
+// PGIngestStep loaded forecast hour of model run
+type PGIngestStep struct {
+	ID           uint64    `gorm:"primaryKey;autoincrement;"`
+	RunTime      time.Time `gorm:"index:idx_ingest_step,unique"`
+	ForecastHour int       `gorm:"index:idx_ingest_step,unique"`
+	Status       string    `gorm:"type:varchar(16)"`
+	Attempts     int
+	StartedAt    time.Time
+	FinishedAt   *time.Time
+	Bytes        int64
+	Rows         int64
+	SourceURLs   []string `gorm:"type:jsonb;serializer:json"`
+	Error        string
+}
+
+func (PGIngestStep) TableName() string {
+	return "ingest_steps"
+}
+
+// PGIngestSummary run with forecast hours counters
+type PGIngestSummary struct {
+	PGIngestRun
+	StepsComplete int
+	StepsFailed   int
+	Rows          int64
+}
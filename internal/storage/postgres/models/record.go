@@ -2,19 +2,20 @@ package models
 
 import "time"
 
+// PGRecord fixed part of "records" table. Variable columns are added from catalog
 type PGRecord struct {
 	ID     uint64 `gorm:"primaryKey;autoincrement;"`
-	GridID int64  `gorm:"index:idx_unique_item,unique"`
+	GridID int64  `gorm:"index:idx_record_level,unique"`
 	// Grid        PGGridInfo `gorm:"constraint:OnDelete:CASCADE"`
-	DateTime    time.Time `gorm:"index:idx_unique_item,unique"`
-	IsGround    bool
-	Pressure    float32
-	Temperature float32
-	UWind       float32
-	VWind       float32
-	CRain       float32
-	RHumidity   float32
-	Visibility  float32
+	// RunTime model run reference time
+	RunTime time.Time `gorm:"index:idx_record_level,unique;index:idx_run_time"`
+	// DateTime valid time
+	DateTime time.Time `gorm:"index:idx_record_level,unique"`
+	// Level isobaric level (hPa), 0 for surface and near-surface variables
+	Level int16 `gorm:"index:idx_record_level,unique;not null;default:0"`
+	// LeadTime hours from RunTime to DateTime
+	LeadTime int16
+	IsGround bool
 }
 
 func (PGRecord) TableName() string {
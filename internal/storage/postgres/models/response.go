@@ -3,12 +3,18 @@ package models
 import "time"
 
 type PGResponse struct {
-	Sec         string
-	Temperature float64
-	Pressure    float64
-	CRain       float64
-	RHumidity   float64
-	UWind       float64
-	VWind       float64
-	Date        time.Time
+	// Segment index of requested segment
+	Segment int
+	Sec     string
+	Date    time.Time
+	Run     time.Time
+	Lead    int
+	// Level isobaric level (hPa), 0 for surface
+	Level int
+	// Values converted values by catalog variable name
+	Values map[string]float64
+	// DX, DY offset of grid node from requested point (degrees), Step grid step.
+	// Point queries only
+	DX, DY, Step float64
+	IsGround     bool
 }
@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"gfsloader/internal/catalog"
 	"gfsloader/internal/storage"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	appModels "gfsloader/internal/models"
 	models "gfsloader/internal/storage/postgres/models"
@@ -22,16 +25,21 @@ const (
 	PG_TIME_FORMAT = "2006-01-02 15:04:05.000 -0700"
 )
 
+// recordKey unique key of "records" table
+var recordKey = []string{"grid_id", "run_time", "date_time", "level"}
+
 type PostgresDataProvider struct {
 	dsn        string
 	db         *gorm.DB
 	gridIsInit bool
+	catalog    *catalog.Catalog
 }
 
-// New create DatabaseApp
-func New(dsn string) *PostgresDataProvider {
+// New create DatabaseApp. Variable columns of "records" table are taken from catalog
+func New(dsn string, cat *catalog.Catalog) *PostgresDataProvider {
 	return &PostgresDataProvider{
-		dsn: dsn,
+		dsn:     dsn,
+		catalog: cat,
 	}
 }
 
@@ -63,15 +71,77 @@ func (d *PostgresDataProvider) runWithDialector(dialector gorm.Dialector) error
 	err = db.AutoMigrate(
 		recordsTable,
 		gridTable,
+		&models.PGIngestRun{},
+		&models.PGIngestStep{},
 	)
 
 	if err != nil {
 		return errors.Join(storage.ErrDatabaseError, err)
 	}
 
+	err = d.migrateRuns()
+	if err != nil {
+		return errors.Join(storage.ErrDatabaseError, err)
+	}
+
+	err = d.migrateLevels()
+	if err != nil {
+		return errors.Join(storage.ErrDatabaseError, err)
+	}
+
+	err = d.migrateCatalog()
+	if err != nil {
+		return errors.Join(storage.ErrDatabaseError, err)
+	}
+
+	if d.gridIsInit {
+		err = d.migrateLongitude()
+		if err != nil {
+			return errors.Join(storage.ErrDatabaseError, err)
+		}
+	}
+
 	return nil
 }
 
+// migrateRuns drop (grid_id, date_time) key of records loaded before runs were
+// stored. Such records get run_time = date_time
+func (d *PostgresDataProvider) migrateRuns() error {
+	table := models.PGRecord{}.TableName()
+	err := d.db.Exec(`DROP INDEX IF EXISTS idx_unique_item`).Error
+	if err != nil {
+		return err
+	}
+	return d.db.Exec(fmt.Sprintf(`UPDATE %s SET run_time = date_time, lead_time = 0 WHERE run_time IS NULL`, table)).Error
+}
+
+// migrateLevels drop (grid_id, run_time, date_time) key of records loaded
+// before isobaric levels were stored. Such records have level 0
+func (d *PostgresDataProvider) migrateLevels() error {
+	return d.db.Exec(`DROP INDEX IF EXISTS idx_record_run`).Error
+}
+
+// migrateCatalog add missing variable columns to "records" table
+func (d *PostgresDataProvider) migrateCatalog() error {
+	table := models.PGRecord{}.TableName()
+	for _, v := range d.catalog.Variables {
+		err := d.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s real`, table, v.Column)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateLongitude move grid cells created in 0..360 frame to -180..180 frame.
+// Cell ids do not change, so records stay linked
+func (d *PostgresDataProvider) migrateLongitude() error {
+	return d.db.Exec(fmt.Sprintf(
+		`UPDATE %s SET geometry = ST_Translate(geometry, -360, 0) WHERE ST_X(ST_Centroid(geometry)) >= 180`,
+		models.PGGridInfo{}.TableName(),
+	)).Error
+}
+
 func (d *PostgresDataProvider) Run() error {
 	return d.runWithDialector(postgres.Open(d.dsn))
 }
@@ -107,7 +177,8 @@ func (d *PostgresDataProvider) Begin(ctx context.Context) (*PostgresDataProvider
 		return nil, errors.Join(storage.ErrDatabaseError, r.Error)
 	}
 	return &PostgresDataProvider{
-		db: r,
+		db:      r,
+		catalog: d.catalog,
 	}, nil
 }
 
@@ -143,49 +214,62 @@ func (d *PostgresDataProvider) AddRecord(ctx context.Context, record appModels.R
 	return nil
 }
 
+// coordToIndex grid cell id. Id is computed in 0..360 longitude frame, so
+// -10 and 350 give the same cell
 func coordToIndex(lat, lng float32) int64 {
+	lng = float32(math.Mod(float64(lng)+360, 360))
 	idx, _ := strconv.Atoi(fmt.Sprintf("%d%06d", int(lat*100), int(lng*100)))
 	return int64(idx)
 }
 
+// leadTime hours from run to valid time
+func leadTime(record *appModels.Record) int16 {
+	return int16(record.DateTime.Sub(record.RunTime) / time.Hour)
+}
+
+// normalizeLng move longitude to -180..180 frame
+func normalizeLng(lng float32) float32 {
+	l := math.Mod(float64(lng)+180, 360)
+	if l < 0 {
+		l += 360
+	}
+	return float32(l - 180)
+}
+
 // SetRecords create or update records
 func (d *PostgresDataProvider) SetRecords(ctx context.Context, records []appModels.Record) error {
 	if len(records) > MAX_BATCH_SIZE {
 		return storage.ErrBatchSize
 	}
 
-	data := make([]models.PGRecord, 0, len(records))
-	for _, record := range records {
-		idx := coordToIndex(record.Lat, record.Lng)
-		dbRecord := models.PGRecord{
-			GridID:      idx,
-			DateTime:    record.DateTime,
-			IsGround:    record.IsGround,
-			Pressure:    record.Pressure,
-			Temperature: record.Temperature,
-			UWind:       record.UWind,
-			VWind:       record.VWind,
-			CRain:       record.CRain,
-			RHumidity:   record.RHUmidity,
-			Visibility:  record.Visibility,
+	data := make([]map[string]interface{}, 0, len(records))
+	for i := range records {
+		record := &records[i]
+		dbRecord := map[string]interface{}{
+			"grid_id":   coordToIndex(record.Lat, record.Lng),
+			"run_time":  record.RunTime,
+			"date_time": record.DateTime,
+			"lead_time": leadTime(record),
+			"is_ground": record.IsGround,
+			"level":     record.Level,
+		}
+		for i, v := range d.catalog.Variables {
+			if i < len(record.Values) {
+				dbRecord[v.Column] = nullable(record.Values[i])
+			}
 		}
 
 		data = append(data, dbRecord)
 	}
 
-	r := d.db.WithContext(ctx).Clauses(clause.OnConflict{
-		Columns: []clause.Column{
-			{Name: "grid_id"},
-			{Name: "date_time"},
-		},
-		DoUpdates: clause.AssignmentColumns([]string{
-			"temperature",
-			"pressure",
-			"u_wind",
-			"v_wind",
-			"c_rain",
-			"r_humidity",
-		}),
+	conflict := make([]clause.Column, 0, len(recordKey))
+	for _, c := range recordKey {
+		conflict = append(conflict, clause.Column{Name: c})
+	}
+
+	r := d.db.WithContext(ctx).Model(&models.PGRecord{}).Clauses(clause.OnConflict{
+		Columns:   conflict,
+		DoUpdates: clause.AssignmentColumns(d.updateColumns()),
 	}).CreateInBatches(data, len(data))
 
 	if r.Error != nil {
@@ -195,6 +279,16 @@ func (d *PostgresDataProvider) SetRecords(ctx context.Context, records []appMode
 	return nil
 }
 
+// updateColumns columns overwritten on conflict
+func (d *PostgresDataProvider) updateColumns() []string {
+	columns := make([]string, 0, len(d.catalog.Variables)+1)
+	columns = append(columns, "is_ground")
+	for _, v := range d.catalog.Variables {
+		columns = append(columns, v.Column)
+	}
+	return columns
+}
+
 type GridGenerate func() ([]appModels.GridInfo, func(writed int))
 
 func (d *PostgresDataProvider) InitGrid(ctx context.Context, gridGenerate GridGenerate) (err error) {
@@ -226,7 +320,7 @@ func (d *PostgresDataProvider) InitGrid(ctx context.Context, gridGenerate GridGe
 		dbRecords := make([]models.PGGridInfo, 0, MAX_BATCH_SIZE)
 
 		for i := 0; i < gridCount; i += MAX_BATCH_SIZE {
-			gridBatch := grid[i:min(i+MAX_BATCH_SIZE, gridCount-1)]
+			gridBatch := grid[i:min(i+MAX_BATCH_SIZE, gridCount)]
 			dbRecords = dbRecords[:0]
 			db, err := d.Begin(ctx)
 			if err != nil {
@@ -236,13 +330,14 @@ func (d *PostgresDataProvider) InitGrid(ctx context.Context, gridGenerate GridGe
 
 				idx := coordToIndex(record.Lat, record.Lng)
 				hSz := record.Size / 2
+				lng := normalizeLng(record.Lng)
 				dbRecord := models.PGGridInfo{
 					ID: idx,
 					Geometry: models.GISRectangle{
 						Y1: float64(record.Lat - hSz),
-						X1: float64(record.Lng - hSz),
+						X1: float64(lng - hSz),
 						Y2: float64(record.Lat + hSz),
-						X2: float64(record.Lng + hSz),
+						X2: float64(lng + hSz),
 					},
 				}
 
@@ -269,9 +364,9 @@ func toSQLValueItem(items []appModels.WKTRequestItem) (string, []interface{}) {
 	vals := make([]interface{}, 0, len(items))
 	for i, item := range items {
 		if i == 0 {
-			result = append(result, "(?::timestamptz,?::timestamptz,st_geomfromtext(?,4326))")
+			result = append(result, "(?::int,?::timestamptz,?::timestamptz,st_geomfromtext(?,4326))")
 		} else {
-			result = append(result, "(?,?,st_geomfromtext(?,4326))")
+			result = append(result, "(?,?,?,st_geomfromtext(?,4326))")
 		}
 		to := item.From
 		if item.To != nil {
@@ -279,6 +374,7 @@ func toSQLValueItem(items []appModels.WKTRequestItem) (string, []interface{}) {
 		}
 		vals = append(
 			vals,
+			i,
 			item.From.Format(PG_TIME_FORMAT),
 			to.Format(PG_TIME_FORMAT),
 			item.WKT,
@@ -288,24 +384,266 @@ func toSQLValueItem(items []appModels.WKTRequestItem) (string, []interface{}) {
 	return strings.Join(result, ","), vals
 }
 
-func (d *PostgresDataProvider) GetForecastBySegments(ctx context.Context, segments []appModels.WKTRequestItem) ([]models.PGResponse, error) {
+// GetForecastBySegments return forecast of run in cells intersecting segments.
+// Nil run means the newest complete run
+func (d *PostgresDataProvider) GetForecastBySegments(ctx context.Context, segments []appModels.WKTRequestItem, variables []catalog.Variable, run *time.Time, levels appModels.LevelFilter) ([]models.PGResponse, error) {
+
+	run, err := d.resolveRun(ctx, run)
+	if errors.Is(err, storage.ErrNotFound) {
+		return []models.PGResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	db := d.db.WithContext(ctx)
 
-	var result []models.PGResponse
+	columns := variableColumns(variables)
+
+	var rows []map[string]interface{}
 	valsSQL, data := toSQLValueItem(segments)
-	err := db.Raw(fmt.Sprintf("WITH "+
-		"q(f,t,geo) AS (VALUES %s),"+
-		"cells AS (SELECT g.geometry AS geo, g.id AS p, q.f as f, q.t as t,ST_Intersection(g.geometry,q.geo) AS s FROM grid g JOIN q ON ST_Intersects(g.geometry ,q.geo))"+
-		"SELECT st_astext(c.s) AS sec,r.temperature - 273.15 AS temperature, r.pressure AS pressure,r.c_rain AS c_rain,r.r_humidity AS r_humidity,r.u_wind AS u_wind,r.v_wind AS v_wind,r.date_time AT TIME ZONE 'UTC' AS date FROM records r JOIN cells c ON c.p=r.grid_id AND r.date_time BETWEEN c.f AND c.t",
+	runFilter, data := recordFilter(*run, levels, data)
+
+	err = db.Raw(fmt.Sprintf("WITH "+
+		"q0(i,f,t,geo) AS (VALUES %s),"+
+		// shapes wider than 180 degrees cross the antimeridian: move them to 0..360
+		"q1 AS (SELECT i,f,t,CASE WHEN ST_XMax(geo)-ST_XMin(geo) > 180 THEN ST_ShiftLongitude(geo) ELSE geo END AS geo FROM q0),"+
+		// grid is in -180..180 frame, shifted copies catch the parts outside of it
+		"q AS (SELECT i,f,t,geo FROM q1 UNION ALL SELECT i,f,t,ST_Translate(geo,-360,0) FROM q1 UNION ALL SELECT i,f,t,ST_Translate(geo,360,0) FROM q1),"+
+		"cells AS (SELECT g.geometry AS geo, g.id AS p, q.i as i, q.f as f, q.t as t,ST_Intersection(g.geometry,q.geo) AS s FROM grid g JOIN q ON ST_Intersects(g.geometry ,q.geo))"+
+		"SELECT c.i AS segment, st_astext(c.s) AS sec,%s r.run_time AS run, r.lead_time AS lead, r.level AS level, r.date_time AT TIME ZONE 'UTC' AS date "+
+		"FROM records r JOIN cells c ON c.p=r.grid_id AND r.date_time BETWEEN c.f AND c.t%s "+
+		"ORDER BY c.i, sec, r.grid_id, r.date_time, r.level DESC",
+		valsSQL,
+		strings.Join(append(columns, ""), ","),
+		runFilter,
+	),
+		data...,
+	).Scan(&rows).Error
+
+	if err != nil {
+		return nil, errors.Join(storage.ErrDatabaseError, err)
+	}
+
+	return responseRows(rows, variables), nil
+}
+
+// GetForecastByPoints return forecast of run at grid nodes around points given
+// as WKT POINT: nodes closer than one grid step in latitude and longitude.
+// Nil run means the newest complete run
+func (d *PostgresDataProvider) GetForecastByPoints(ctx context.Context, points []appModels.WKTRequestItem, variables []catalog.Variable, run *time.Time, levels appModels.LevelFilter) ([]models.PGResponse, error) {
+
+	run, err := d.resolveRun(ctx, run)
+	if errors.Is(err, storage.ErrNotFound) {
+		return []models.PGResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db := d.db.WithContext(ctx)
+
+	columns := variableColumns(variables)
+
+	var rows []map[string]interface{}
+	valsSQL, data := toSQLValueItem(points)
+	runFilter, data := recordFilter(*run, levels, data)
+
+	err = db.Raw(fmt.Sprintf("WITH "+
+		"q0(i,f,t,geo) AS (VALUES %s),"+
+		// grid is in -180..180 frame, shifted copies catch nodes across the antimeridian
+		"q AS (SELECT i,f,t,ST_X(geo) AS x,ST_Y(geo) AS y FROM q0 UNION ALL SELECT i,f,t,ST_X(geo)-360,ST_Y(geo) FROM q0 UNION ALL SELECT i,f,t,ST_X(geo)+360,ST_Y(geo) FROM q0),"+
+		"step AS (SELECT ST_XMax(geometry)-ST_XMin(geometry) AS s FROM grid LIMIT 1),"+
+		"nodes AS (SELECT g.id AS p, q.i AS i, q.f AS f, q.t AS t, ST_X(ST_Centroid(g.geometry))-q.x AS dx, ST_Y(ST_Centroid(g.geometry))-q.y AS dy, step.s AS s "+
+		"FROM q CROSS JOIN step JOIN grid g ON g.geometry && ST_MakeEnvelope(q.x-step.s,q.y-step.s,q.x+step.s,q.y+step.s,4326)),"+
+		"near AS (SELECT * FROM nodes WHERE abs(dx) < s AND abs(dy) < s)"+
+		"SELECT n.i AS segment, n.dx AS dx, n.dy AS dy, n.s AS step, r.is_ground AS ground,%s r.run_time AS run, r.lead_time AS lead, r.level AS level, r.date_time AT TIME ZONE 'UTC' AS date "+
+		"FROM records r JOIN near n ON n.p=r.grid_id AND r.date_time BETWEEN n.f AND n.t%s "+
+		"ORDER BY n.i, r.date_time, r.level DESC, r.grid_id",
 		valsSQL,
+		strings.Join(append(columns, ""), ","),
+		runFilter,
 	),
 		data...,
-	).Scan(&result).Error
+	).Scan(&rows).Error
 
 	if err != nil {
 		return nil, errors.Join(storage.ErrDatabaseError, err)
 	}
 
+	result := responseRows(rows, variables)
+	for n, row := range rows {
+		result[n].DX, _ = toFloat(row["dx"])
+		result[n].DY, _ = toFloat(row["dy"])
+		result[n].Step, _ = toFloat(row["step"])
+		result[n].IsGround, _ = row["ground"].(bool)
+	}
+
 	return result, nil
 }
+
+// resolveRun return run, or the newest complete run when run is nil
+func (d *PostgresDataProvider) resolveRun(ctx context.Context, run *time.Time) (*time.Time, error) {
+	if run != nil {
+		return run, nil
+	}
+	latest, err := d.LatestCompleteRun(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &latest, nil
+}
+
+// variableColumns select list of variable columns, aliased v0, v1, ...
+func variableColumns(variables []catalog.Variable) []string {
+	columns := make([]string, 0, len(variables))
+	for i, v := range variables {
+		columns = append(columns, fmt.Sprintf("r.%s AS v%d", v.Column, i))
+	}
+	return columns
+}
+
+// recordFilter conditions on run and level of records. Return SQL appended to
+// JOIN condition and data with condition arguments
+func recordFilter(run time.Time, levels appModels.LevelFilter, data []interface{}) (string, []interface{}) {
+	filter := " AND r.run_time = ?::timestamptz"
+	data = append(data, run.Format(PG_TIME_FORMAT))
+
+	if levels.Column {
+		filter += " AND r.level > 0"
+	} else {
+		filter += " AND r.level = ?"
+		data = append(data, levels.Level)
+	}
+	return filter, data
+}
+
+// responseRows convert rows of forecast queries
+func responseRows(rows []map[string]interface{}, variables []catalog.Variable) []models.PGResponse {
+	result := make([]models.PGResponse, 0, len(rows))
+	for _, row := range rows {
+		item := models.PGResponse{
+			Values: make(map[string]float64, len(variables)),
+		}
+		item.Sec, _ = row["sec"].(string)
+		item.Date, _ = row["date"].(time.Time)
+		item.Run, _ = row["run"].(time.Time)
+		item.Run = item.Run.UTC()
+		if lead, ok := toFloat(row["lead"]); ok {
+			item.Lead = int(lead)
+		}
+		if level, ok := toFloat(row["level"]); ok {
+			item.Level = int(level)
+		}
+		if segment, ok := toFloat(row["segment"]); ok {
+			item.Segment = int(segment)
+		}
+		for i, v := range variables {
+			if value, ok := toFloat(row[fmt.Sprintf("v%d", i)]); ok {
+				item.Values[v.Name] = v.Convert(value)
+			}
+		}
+		result = append(result, item)
+	}
+
+	return result
+}
+
+// nullable return nil for missing (NaN) value
+func nullable(value float32) interface{} {
+	if math.IsNaN(float64(value)) {
+		return nil
+	}
+	return value
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// PruneRuns delete records and ledger entries of runs older than keep newest
+// complete runs in one transaction. Runs still loading and loaded run (zero
+// time if none) are kept. Return deleted records count
+func (d *PostgresDataProvider) PruneRuns(ctx context.Context, keep int, loaded time.Time) (int64, error) {
+	if keep <= 0 {
+		return 0, nil
+	}
+
+	table := models.PGRecord{}.TableName()
+	var deleted int64
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var runs []models.PGIngestRun
+		err := tx.Order("run_time DESC").Find(&runs).Error
+		if err != nil {
+			return err
+		}
+
+		cutoff, kept, ok := pruneBefore(runs, keep, loaded)
+		if !ok {
+			return nil
+		}
+
+		cond, args := "run_time < ?", []interface{}{cutoff}
+		if len(kept) > 0 {
+			cond += " AND run_time NOT IN ?"
+			args = append(args, kept)
+		}
+
+		r := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", table, cond), args...)
+		if r.Error != nil {
+			return r.Error
+		}
+		deleted = r.RowsAffected
+
+		err = tx.Where(cond, args...).Delete(&models.PGIngestStep{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where(cond, args...).Delete(&models.PGIngestRun{}).Error
+	})
+
+	if err != nil {
+		return 0, errors.Join(storage.ErrDatabaseError, err)
+	}
+
+	return deleted, nil
+}
+
+// pruneBefore return the oldest of keep newest complete runs of ledger runs
+// (newest first) and older runs which are not deleted: running ones and
+// loaded. ok is false when fewer than keep runs are complete
+func pruneBefore(runs []models.PGIngestRun, keep int, loaded time.Time) (cutoff time.Time, kept []time.Time, ok bool) {
+	complete := 0
+	for _, run := range runs {
+		if run.Status != models.IngestStatusComplete {
+			continue
+		}
+		if complete++; complete == keep {
+			cutoff, ok = run.RunTime, true
+			break
+		}
+	}
+	if !ok {
+		return time.Time{}, nil, false
+	}
+
+	for _, run := range runs {
+		if run.RunTime.Before(cutoff) && (run.Status == models.IngestStatusRunning || run.RunTime.Equal(loaded)) {
+			kept = append(kept, run.RunTime)
+		}
+	}
+	return cutoff, kept, true
+}
@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	models "gfsloader/internal/storage/postgres/models"
+)
+
+func TestNormalizeLng(t *testing.T) {
+	tests := []struct {
+		lng, want float32
+	}{
+		{0, 0},
+		{90, 90},
+		{179.75, 179.75},
+		{180, -180},
+		{-180, -180},
+		{190, -170},
+		{359.75, -0.25},
+		{360, 0},
+		{-190, 170},
+		{540, -180},
+		{-359.5, 0.5},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeLng(tt.lng); got != tt.want {
+			t.Errorf("normalizeLng(%v) = %v, want %v", tt.lng, got, tt.want)
+		}
+	}
+}
+
+func TestCoordToIndex(t *testing.T) {
+	tests := []struct {
+		lat, lng float32
+		want     int64
+	}{
+		{0, 0, 0},
+		{10.5, 20.25, 1050002025},
+		{-10.5, 20.25, -1050002025},
+		{45, 350, 4500035000},
+		// the same cell in -180..180 frame
+		{45, -10, 4500035000},
+		{-90, -180, -9000018000},
+		{-90, 180, -9000018000},
+	}
+
+	for _, tt := range tests {
+		if got := coordToIndex(tt.lat, tt.lng); got != tt.want {
+			t.Errorf("coordToIndex(%v, %v) = %v, want %v", tt.lat, tt.lng, got, tt.want)
+		}
+	}
+}
+
+func TestPruneBefore(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC).Add(time.Duration(hour) * time.Hour)
+	}
+	run := func(hour int, status string) models.PGIngestRun {
+		return models.PGIngestRun{RunTime: at(hour), Status: status}
+	}
+	const (
+		complete = models.IngestStatusComplete
+		running  = models.IngestStatusRunning
+		failed   = models.IngestStatusFailed
+	)
+
+	tests := []struct {
+		name   string
+		runs   []models.PGIngestRun
+		keep   int
+		loaded time.Time
+		cutoff time.Time
+		kept   []time.Time
+		ok     bool
+	}{
+		{
+			name: "complete runs",
+			runs: []models.PGIngestRun{run(18, complete), run(12, complete), run(6, complete)},
+			keep: 2, cutoff: at(12), ok: true,
+		},
+		{
+			// partial run newer than the last complete run does not count
+			name: "partial run newer than complete",
+			runs: []models.PGIngestRun{run(18, running), run(12, complete), run(6, complete)},
+			keep: 1, cutoff: at(12), ok: true,
+		},
+		{
+			name: "failed run newer than complete",
+			runs: []models.PGIngestRun{run(18, failed), run(12, complete), run(6, failed), run(0, complete)},
+			keep: 1, cutoff: at(12), ok: true,
+		},
+		{
+			name: "running run older than cutoff is kept",
+			runs: []models.PGIngestRun{run(18, complete), run(12, running), run(6, failed)},
+			keep: 1, cutoff: at(18), kept: []time.Time{at(12)}, ok: true,
+		},
+		{
+			// run loaded with explicit date older than kept runs
+			name: "loaded older run is kept",
+			runs: []models.PGIngestRun{run(18, complete), run(12, complete), run(0, complete)},
+			keep: 1, loaded: at(0), cutoff: at(18), kept: []time.Time{at(0)}, ok: true,
+		},
+		{
+			name: "fewer complete runs than keep",
+			runs: []models.PGIngestRun{run(18, running), run(12, complete), run(6, failed)},
+			keep: 2,
+		},
+		{
+			name: "no runs",
+			keep: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cutoff, kept, ok := pruneBefore(tt.runs, tt.keep, tt.loaded)
+			if ok != tt.ok || !cutoff.Equal(tt.cutoff) {
+				t.Errorf("cutoff %v, %v, want %v, %v", cutoff, ok, tt.cutoff, tt.ok)
+			}
+			if !slices.EqualFunc(kept, tt.kept, time.Time.Equal) {
+				t.Errorf("kept %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+// Package download fetch files over HTTP with resume, size check and retries
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+const (
+	DefaultMaxRetries = 5
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = time.Minute
+)
+
+var (
+	ErrDownload     = errors.New("download error")
+	ErrStatus       = errors.New("unexpected status code")
+	ErrSizeMismatch = errors.New("received size mismatch")
+)
+
+// retryableError error worth another attempt (5xx, 429, 403 of throttling
+// hosts, network failure, short body). after is delay asked by server with Retry-After
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e retryableError) Error() string { return e.err.Error() }
+func (e retryableError) Unwrap() error { return e.err }
+
+type Downloader struct {
+	Client     *http.Client
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// ShowProgress draw progress bar for every download
+	ShowProgress bool
+	// ThrottlesForbidden report host answers 403 to clients over its request
+	// rate, as NOMADS does. 403 is retried only for such hosts, nil means never
+	ThrottlesForbidden func(host string) bool
+}
+
+// New create Downloader with default retry policy
+func New() *Downloader {
+	return &Downloader{
+		Client:       http.DefaultClient,
+		MaxRetries:   DefaultMaxRetries,
+		MinBackoff:   DefaultMinBackoff,
+		MaxBackoff:   DefaultMaxBackoff,
+		ShowProgress: true,
+	}
+}
+
+// Download save bytes from..to (inclusive) of url to destinationPath.
+// to == 0 means up to the end of file. Data is written to destinationPath + ".tmp"
+// and renamed after the size is checked; a partial .tmp file is resumed
+func (d *Downloader) Download(ctx context.Context, label, destinationPath, url string, from, to uint64) error {
+	return d.retry(ctx, func() error {
+		return d.try(ctx, label, destinationPath, url, from, to)
+	})
+}
+
+// Exists check url is published with HEAD request. Failed and throttled
+// requests are retried like downloads
+func (d *Downloader) Exists(ctx context.Context, url string) (bool, error) {
+	var found bool
+	err := d.retry(ctx, func() error {
+		var err error
+		found, _, err = d.head(ctx, url)
+		return err
+	})
+	return found, err
+}
+
+// Size return Content-Length of url reported to HEAD request, 0 when it is
+// unknown. Missing url is an error
+func (d *Downloader) Size(ctx context.Context, url string) (uint64, error) {
+	var (
+		found bool
+		size  int64
+	)
+	err := d.retry(ctx, func() error {
+		var err error
+		found, size, err = d.head(ctx, url)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, errors.Join(ErrDownload, fmt.Errorf("%w: %d : %s", ErrStatus, http.StatusNotFound, url))
+	}
+	return uint64(max(size, 0)), nil
+}
+
+// retry call try until it succeeds, fails with not retryable error or
+// MaxRetries is exceeded
+func (d *Downloader) retry(ctx context.Context, try func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = try()
+		if err == nil {
+			return nil
+		}
+
+		var retryable retryableError
+		if !errors.As(err, &retryable) || attempt >= d.MaxRetries {
+			return errors.Join(ErrDownload, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(ErrDownload, ctx.Err(), err)
+		case <-time.After(max(d.backoff(attempt), retryable.after)):
+		}
+	}
+}
+
+// backoff exponential delay with full jitter
+func (d *Downloader) backoff(attempt int) time.Duration {
+	delay := d.MinBackoff << attempt
+	if delay <= 0 || delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func (d *Downloader) try(ctx context.Context, label, destinationPath, url string, from, to uint64) error {
+	tempDestinationPath := destinationPath + ".tmp"
+
+	var expected int64 = -1
+	if to != 0 {
+		expected = int64(to - from + 1)
+	}
+
+	var have int64
+	if st, err := os.Stat(tempDestinationPath); err == nil {
+		have = st.Size()
+	}
+
+	if expected >= 0 && have > expected {
+		os.Remove(tempDestinationPath)
+		have = 0
+	}
+
+	if expected >= 0 && have == expected {
+		return os.Rename(tempDestinationPath, destinationPath)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	start := from + uint64(have)
+	if start != 0 || to != 0 {
+		end := ""
+		if to != 0 {
+			end = fmt.Sprint(to)
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%s", start, end))
+	}
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return retryableError{err: err}
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusOK:
+		// range ignored by server: whole file is sent
+		if from != 0 || to != 0 {
+			return fmt.Errorf("%w: range not supported: %s", ErrStatus, url)
+		}
+		flags |= os.O_TRUNC
+		have = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && have > 0:
+		// stale partial file, start from scratch
+		os.Remove(tempDestinationPath)
+		return retryableError{err: fmt.Errorf("%w: %d : %s", ErrStatus, resp.StatusCode, url)}
+	default:
+		return d.statusError(resp, url)
+	}
+
+	if expected < 0 && resp.ContentLength >= 0 {
+		expected = have + resp.ContentLength
+	}
+
+	f, err := os.OpenFile(tempDestinationPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = f
+	if d.ShowProgress {
+		bar := progressbar.DefaultBytes(resp.ContentLength, label)
+		defer bar.Close()
+		w = io.MultiWriter(f, bar)
+	}
+
+	n, copyErr := io.Copy(w, resp.Body)
+	closeErr := f.Close()
+	if closeErr != nil {
+		return closeErr
+	}
+	if copyErr != nil {
+		if ctx.Err() != nil {
+			return copyErr
+		}
+		return retryableError{err: copyErr}
+	}
+
+	if received := have + n; expected >= 0 && received != expected {
+		if received > expected {
+			os.Remove(tempDestinationPath)
+		}
+		return retryableError{err: fmt.Errorf("%w: got %d bytes, expected %d : %s", ErrSizeMismatch, received, expected, url)}
+	}
+
+	return os.Rename(tempDestinationPath, destinationPath)
+}
+
+// head check url with HEAD request: true on 200, false on 404. size is
+// Content-Length, -1 when unknown
+func (d *Downloader) head(ctx context.Context, url string) (found bool, size int64, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return false, -1, err
+	}
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, -1, err
+		}
+		return false, -1, retryableError{err: err}
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, resp.ContentLength, nil
+	case http.StatusNotFound:
+		return false, -1, nil
+	default:
+		return false, -1, d.statusError(resp, url)
+	}
+}
+
+// statusError error of unexpected status code, retryable for 429, 5xx and
+// 403 of throttling hosts
+func (d *Downloader) statusError(resp *http.Response, url string) error {
+	err := fmt.Errorf("%w: %d : %s", ErrStatus, resp.StatusCode, url)
+
+	throttled := resp.StatusCode == http.StatusForbidden && d.ThrottlesForbidden != nil && d.ThrottlesForbidden(resp.Request.URL.Host)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 || throttled {
+		after, _ := RetryAfter(resp, time.Now())
+		return retryableError{err: err, after: after}
+	}
+	return err
+}
@@ -0,0 +1,296 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testContent = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// testServer serve testContent with Range support. Requests are answered by
+// queued handlers first
+type testServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	queue    []http.HandlerFunc
+	requests []string
+}
+
+func newTestServer(queue ...http.HandlerFunc) *testServer {
+	s := &testServer{queue: queue}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.Header.Get("Range"))
+		var h http.HandlerFunc
+		if len(s.queue) > 0 {
+			h, s.queue = s.queue[0], s.queue[1:]
+		}
+		s.mu.Unlock()
+
+		if h != nil {
+			h(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(testContent))
+	}))
+	return s
+}
+
+func status(code int, retryAfter string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(code)
+	}
+}
+
+// short answer range with the first n bytes only
+func short(n int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var from, to int
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &from, &to)
+		if to == 0 {
+			to = len(testContent) - 1
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", from, to, len(testContent)))
+		w.Header().Set("Content-Length", strconv.Itoa(to-from+1))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(testContent[from : from+n]))
+	}
+}
+
+func testDownloader(s *testServer) *Downloader {
+	d := New()
+	d.Client = s.Client()
+	d.MinBackoff = time.Millisecond
+	d.MaxBackoff = time.Millisecond
+	d.ShowProgress = false
+	return d
+}
+
+func TestDownload(t *testing.T) {
+	tests := []struct {
+		name     string
+		queue    []http.HandlerFunc
+		from, to uint64
+		// partial content of .tmp file before download
+		partial string
+		want    string
+		// requests Range headers of requests
+		requests []string
+		wantErr  error
+	}{
+		{
+			name:     "whole file",
+			want:     testContent,
+			requests: []string{"GET "},
+		},
+		{
+			name:     "range",
+			from:     10,
+			to:       15,
+			want:     "abcdef",
+			requests: []string{"GET bytes=10-15"},
+		},
+		{
+			name:     "range to the end",
+			from:     30,
+			want:     "uvwxyz",
+			requests: []string{"GET bytes=30-"},
+		},
+		{
+			name:     "resume partial file",
+			from:     10,
+			to:       19,
+			partial:  "abcd",
+			want:     "abcdefghij",
+			requests: []string{"GET bytes=14-19"},
+		},
+		{
+			name:     "complete partial file is not requested",
+			from:     10,
+			to:       12,
+			partial:  "abc",
+			want:     "abc",
+			requests: nil,
+		},
+		{
+			name:     "oversized partial file is dropped",
+			from:     10,
+			to:       12,
+			partial:  "abcdef",
+			want:     "abc",
+			requests: []string{"GET bytes=10-12"},
+		},
+		{
+			name:     "short body is resumed",
+			queue:    []http.HandlerFunc{short(3)},
+			from:     10,
+			to:       19,
+			want:     "abcdefghij",
+			requests: []string{"GET bytes=10-19", "GET bytes=13-19"},
+		},
+		{
+			name:     "5xx and 429 are retried",
+			queue:    []http.HandlerFunc{status(http.StatusBadGateway, ""), status(http.StatusTooManyRequests, "0")},
+			from:     0,
+			to:       3,
+			want:     "0123",
+			requests: []string{"GET bytes=0-3", "GET bytes=0-3", "GET bytes=0-3"},
+		},
+		{
+			name:     "404 is not retried",
+			queue:    []http.HandlerFunc{status(http.StatusNotFound, "")},
+			requests: []string{"GET "},
+			wantErr:  ErrStatus,
+		},
+		{
+			name:     "403 is not retried",
+			queue:    []http.HandlerFunc{status(http.StatusForbidden, "")},
+			requests: []string{"GET "},
+			wantErr:  ErrStatus,
+		},
+		{
+			name:     "retries are limited",
+			queue:    []http.HandlerFunc{status(500, ""), status(500, ""), status(500, ""), status(500, "")},
+			requests: []string{"GET ", "GET ", "GET "},
+			wantErr:  ErrStatus,
+		},
+		{
+			name:     "range ignored by server",
+			queue:    []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(testContent)) }},
+			from:     10,
+			to:       12,
+			requests: []string{"GET bytes=10-12"},
+			wantErr:  ErrStatus,
+		},
+		{
+			name:     "stale partial file",
+			queue:    []http.HandlerFunc{status(http.StatusRequestedRangeNotSatisfiable, "")},
+			from:     30,
+			partial:  "uvw",
+			want:     "uvwxyz",
+			requests: []string{"GET bytes=33-", "GET bytes=30-"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(tt.queue...)
+			defer srv.Close()
+
+			d := testDownloader(srv)
+			d.MaxRetries = 2
+
+			dest := filepath.Join(t.TempDir(), "file")
+			if tt.partial != "" {
+				if err := os.WriteFile(dest+".tmp", []byte(tt.partial), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := d.Download(context.Background(), "", dest, srv.URL, tt.from, tt.to)
+			if got := fmt.Sprint(srv.requests); got != fmt.Sprint(tt.requests) {
+				t.Errorf("requests %s, want %s", got, fmt.Sprint(tt.requests))
+			}
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, ErrDownload) || !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("file of failed download exists: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("got %q, want %q", b, tt.want)
+			}
+			if _, err := os.Stat(dest + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("temporary file is left: %v", err)
+			}
+		})
+	}
+}
+
+func TestDownloadRetryAfter(t *testing.T) {
+	srv := newTestServer(status(http.StatusServiceUnavailable, "1"))
+	defer srv.Close()
+
+	d := testDownloader(srv)
+	start := time.Now()
+	if err := d.Download(context.Background(), "", filepath.Join(t.TempDir(), "file"), srv.URL, 0, 3); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want Retry-After 1s", elapsed)
+	}
+}
+
+func TestDownloadContext(t *testing.T) {
+	srv := newTestServer(status(http.StatusServiceUnavailable, "60"))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := testDownloader(srv).Download(ctx, "", filepath.Join(t.TempDir(), "file"), srv.URL, 0, 3)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		queue   []http.HandlerFunc
+		size    uint64
+		wantErr error
+	}{
+		{"content length", nil, uint64(len(testContent)), nil},
+		{"retried 503", []http.HandlerFunc{status(http.StatusServiceUnavailable, "")}, uint64(len(testContent)), nil},
+		{"not found", []http.HandlerFunc{status(http.StatusNotFound, "")}, 0, ErrStatus},
+		{"forbidden", []http.HandlerFunc{status(http.StatusForbidden, "")}, 0, ErrStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(tt.queue...)
+			defer srv.Close()
+
+			size, err := testDownloader(srv).Size(context.Background(), srv.URL)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != tt.size {
+				t.Errorf("size %d, want %d", size, tt.size)
+			}
+		})
+	}
+}
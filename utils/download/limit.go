@@ -0,0 +1,395 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMinPenalty pause of host after the first 429 (403) without Retry-After
+	DefaultMinPenalty = 10 * time.Second
+	// DefaultMaxPenalty limit of pause doubled on every following 429 (403)
+	DefaultMaxPenalty = 5 * time.Minute
+
+	// maxReadChunk bytes read at once by bandwidth limited body
+	maxReadChunk = 32 << 10
+)
+
+var (
+	ErrBadLimits = errors.New("bad download limits")
+)
+
+// Limits request limits of host. Zero values are unlimited
+type Limits struct {
+	// Rate requests per second, refilled into token bucket of Burst requests
+	Rate  float64
+	Burst int
+	// Connections concurrent requests
+	Connections int
+	// Bandwidth bytes per second of response bodies
+	Bandwidth int64
+}
+
+// ParseLimits parse limits like "rate=100/m,burst=10,connections=4,bandwidth=20M".
+// Rate is per second unless /s, /m or /h is given, bandwidth takes K, M and G
+// suffixes. Keys not given keep values of base
+func ParseLimits(s string, base Limits) (Limits, error) {
+	res := base
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return Limits{}, fmt.Errorf("%w: %q: expected key=value", ErrBadLimits, item)
+		}
+
+		var err error
+		switch strings.TrimSpace(key) {
+		case "rate":
+			res.Rate, err = parseRate(strings.TrimSpace(value))
+		case "burst":
+			res.Burst, err = strconv.Atoi(strings.TrimSpace(value))
+		case "connections":
+			res.Connections, err = strconv.Atoi(strings.TrimSpace(value))
+		case "bandwidth":
+			res.Bandwidth, err = parseBytes(strings.TrimSpace(value))
+		default:
+			err = errors.New("unknown key")
+		}
+		if err == nil && (res.Rate < 0 || res.Burst < 0 || res.Connections < 0 || res.Bandwidth < 0) {
+			err = errors.New("must not be negative")
+		}
+		if err != nil {
+			return Limits{}, fmt.Errorf("%w: %q: %w", ErrBadLimits, item, err)
+		}
+	}
+	return res, nil
+}
+
+func parseRate(v string) (float64, error) {
+	count, per, _ := strings.Cut(v, "/")
+	rate, err := strconv.ParseFloat(count, 64)
+	if err != nil {
+		return 0, err
+	}
+	switch per {
+	case "", "s":
+	case "m":
+		rate /= 60
+	case "h":
+		rate /= 3600
+	default:
+		return 0, fmt.Errorf("unknown period %q", per)
+	}
+	return rate, nil
+}
+
+func parseBytes(v string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(v, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(v, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(v, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	return n * mult, err
+}
+
+// Limiter request rate, connections and bandwidth limits of hosts shared by
+// every request of HTTP client. Hosts answering 429 (or 403 for ForbiddenHosts) are paused
+type Limiter struct {
+	// Default limits of hosts missing in Hosts
+	Default Limits
+	// Hosts limits by host (with port if URL has it)
+	Hosts map[string]Limits
+	// ForbiddenHosts hosts answering 403 to clients over request rate (NOMADS).
+	// 403 of other hosts, e.g. S3 credential error, is not throttling
+	ForbiddenHosts map[string]bool
+	MinPenalty     time.Duration
+	MaxPenalty     time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimiter
+}
+
+// NewLimiter create limiter applying def to every host
+func NewLimiter(def Limits) *Limiter {
+	return &Limiter{
+		Default:        def,
+		Hosts:          make(map[string]Limits),
+		ForbiddenHosts: make(map[string]bool),
+		MinPenalty:     DefaultMinPenalty,
+		MaxPenalty:     DefaultMaxPenalty,
+		hosts:          make(map[string]*hostLimiter),
+	}
+}
+
+// hostLimiter state of host
+type hostLimiter struct {
+	limits Limits
+	// conns connection slots, nil when unlimited
+	conns chan struct{}
+
+	mu sync.Mutex
+	// tokens requests available at last
+	tokens float64
+	last   time.Time
+	// byteTokens bytes available at byteLast, negative when read ahead
+	byteTokens float64
+	byteLast   time.Time
+	// pausedUntil requests wait for the end of back-off
+	pausedUntil time.Time
+	penalty     time.Duration
+}
+
+func (l *Limiter) host(host string) *hostLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if h, ok := l.hosts[host]; ok {
+		return h
+	}
+
+	limits, ok := l.Hosts[host]
+	if !ok {
+		limits = l.Default
+	}
+	h := &hostLimiter{
+		limits:     limits,
+		tokens:     float64(max(limits.Burst, 1)),
+		byteTokens: float64(limits.Bandwidth),
+	}
+	if limits.Connections > 0 {
+		h.conns = make(chan struct{}, limits.Connections)
+	}
+	l.hosts[host] = h
+	return h
+}
+
+// Acquire wait for connection slot, request token and the end of back-off
+// of host. release must be called when the request is finished
+func (l *Limiter) Acquire(ctx context.Context, host string) (release func(), err error) {
+	h := l.host(host)
+
+	if h.conns != nil {
+		select {
+		case h.conns <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release = func() {
+		if h.conns != nil {
+			<-h.conns
+		}
+	}
+
+	for {
+		wait := h.take(time.Now())
+		if wait <= 0 {
+			return release, nil
+		}
+		if err := sleep(ctx, wait); err != nil {
+			release()
+			return nil, err
+		}
+	}
+}
+
+// take consume request token. Return delay before the next try when no token
+// is available or host is paused
+func (h *hostLimiter) take(now time.Time) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if now.Before(h.pausedUntil) {
+		return h.pausedUntil.Sub(now)
+	}
+	if h.limits.Rate <= 0 {
+		return 0
+	}
+
+	burst := float64(max(h.limits.Burst, 1))
+	if !h.last.IsZero() {
+		h.tokens = math.Min(burst, h.tokens+now.Sub(h.last).Seconds()*h.limits.Rate)
+	}
+	h.last = now
+
+	if h.tokens >= 1 {
+		h.tokens--
+		return 0
+	}
+	return time.Duration((1 - h.tokens) / h.limits.Rate * float64(time.Second))
+}
+
+// Throttle pause host for retryAfter, or for doubled penalty when it is 0
+func (l *Limiter) Throttle(host string, retryAfter time.Duration) {
+	h := l.host(host)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pause := retryAfter
+	if pause <= 0 {
+		h.penalty = min(max(h.penalty*2, l.MinPenalty), l.MaxPenalty)
+		pause = h.penalty
+	}
+	if until := time.Now().Add(pause); until.After(h.pausedUntil) {
+		h.pausedUntil = until
+	}
+}
+
+// ThrottlesForbidden check 403 of host means request rate is exceeded
+func (l *Limiter) ThrottlesForbidden(host string) bool {
+	return l.ForbiddenHosts[host]
+}
+
+// Succeed reset penalty of host after successful response
+func (l *Limiter) Succeed(host string) {
+	h := l.host(host)
+	h.mu.Lock()
+	h.penalty = 0
+	h.mu.Unlock()
+}
+
+// waitBytes take n bytes of bandwidth of host and return delay paying off
+// bytes read ahead
+func (h *hostLimiter) waitBytes(now time.Time, n int) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rate := float64(h.limits.Bandwidth)
+	if !h.byteLast.IsZero() {
+		h.byteTokens = math.Min(rate, h.byteTokens+now.Sub(h.byteLast).Seconds()*rate)
+	}
+	h.byteLast = now
+
+	h.byteTokens -= float64(n)
+	if h.byteTokens >= 0 {
+		return 0
+	}
+	return time.Duration(-h.byteTokens / rate * float64(time.Second))
+}
+
+// Transport return round tripper applying limits to requests of base
+func (l *Limiter) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &limitedTransport{base: base, limiter: l}
+}
+
+type limitedTransport struct {
+	base    http.RoundTripper
+	limiter *Limiter
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	release, err := t.limiter.Acquire(req.Context(), host)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	switch retryAfter, ok := RetryAfter(resp, time.Now()); {
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusForbidden && t.limiter.ThrottlesForbidden(host):
+		t.limiter.Throttle(host, retryAfter)
+	case ok && retryAfter > 0:
+		// 503 and others asking to retry later
+		t.limiter.Throttle(host, retryAfter)
+	case resp.StatusCode < 400:
+		t.limiter.Succeed(host)
+	}
+
+	h := t.limiter.host(host)
+	resp.Body = &limitedBody{
+		ReadCloser: resp.Body,
+		ctx:        req.Context(),
+		host:       h,
+		release:    sync.OnceFunc(release),
+	}
+	return resp, nil
+}
+
+// limitedBody response body holding connection slot until closed, read at
+// bandwidth of host
+type limitedBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	host    *hostLimiter
+	release func()
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.host.limits.Bandwidth <= 0 {
+		return b.ReadCloser.Read(p)
+	}
+
+	if len(p) > maxReadChunk {
+		p = p[:maxReadChunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if wait := b.host.waitBytes(time.Now(), n); wait > 0 {
+			if sleepErr := sleep(b.ctx, wait); sleepErr != nil && err == nil {
+				err = sleepErr
+			}
+		}
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// RetryAfter return delay of Retry-After header (seconds or HTTP date).
+// ok is false when header is missing or malformed
+func RetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	v := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,255 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseLimits(t *testing.T) {
+	base := Limits{Rate: 1, Burst: 2, Connections: 3, Bandwidth: 4}
+
+	tests := []struct {
+		name    string
+		s       string
+		want    Limits
+		wantErr bool
+	}{
+		{"empty keeps base", "", base, false},
+		{"every key", "rate=5,burst=10,connections=4,bandwidth=20", Limits{5, 10, 4, 20}, false},
+		{"spaces", " rate = 5 , burst=1 ", Limits{5, 1, 3, 4}, false},
+		{"rate per second", "rate=2/s", Limits{2, 2, 3, 4}, false},
+		{"rate per minute", "rate=120/m", Limits{2, 2, 3, 4}, false},
+		{"rate per hour", "rate=7200/h", Limits{2, 2, 3, 4}, false},
+		{"bandwidth K", "bandwidth=2K", Limits{1, 2, 3, 2 << 10}, false},
+		{"bandwidth M", "bandwidth=20M", Limits{1, 2, 3, 20 << 20}, false},
+		{"bandwidth G", "bandwidth=1G", Limits{1, 2, 3, 1 << 30}, false},
+		{"zero is unlimited", "connections=0", Limits{1, 2, 0, 4}, false},
+		{"missing value", "rate", Limits{}, true},
+		{"unknown key", "speed=1", Limits{}, true},
+		{"unknown period", "rate=1/d", Limits{}, true},
+		{"bad number", "burst=many", Limits{}, true},
+		{"bad bandwidth", "bandwidth=1T", Limits{}, true},
+		{"negative", "connections=-1", Limits{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLimits(tt.s, base)
+			if tt.wantErr {
+				if !errors.Is(err, ErrBadLimits) {
+					t.Errorf("error %v, want ErrBadLimits", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimits(%q) = %+v, want %+v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTake(t *testing.T) {
+	l := NewLimiter(Limits{Rate: 2, Burst: 3})
+	h := l.host("example.com")
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		after time.Duration
+		want  time.Duration
+	}{
+		// burst
+		{0, 0},
+		{0, 0},
+		{0, 0},
+		// empty bucket refills at 2 per second
+		{0, 500 * time.Millisecond},
+		{250 * time.Millisecond, 250 * time.Millisecond},
+		{250 * time.Millisecond, 0},
+		// refill is limited by burst
+		{10 * time.Second, 0},
+		{0, 0},
+		{0, 0},
+		{0, 500 * time.Millisecond},
+	}
+
+	for n, s := range steps {
+		now = now.Add(s.after)
+		if got := h.take(now); got != s.want {
+			t.Errorf("step %d: take = %s, want %s", n, got, s.want)
+		}
+	}
+
+	// paused host waits for the end of pause, rate or not
+	h.pausedUntil = now.Add(3 * time.Second)
+	if got := h.take(now); got != 3*time.Second {
+		t.Errorf("take of paused host = %s, want 3s", got)
+	}
+	unlimited := NewLimiter(Limits{}).host("example.com")
+	unlimited.pausedUntil = now.Add(time.Second)
+	if got := unlimited.take(now); got != time.Second {
+		t.Errorf("take of paused unlimited host = %s, want 1s", got)
+	}
+	if got := unlimited.take(now.Add(time.Second)); got != 0 {
+		t.Errorf("take of unlimited host = %s, want 0", got)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	l := NewLimiter(Limits{})
+	l.MinPenalty, l.MaxPenalty = time.Second, 3*time.Second
+	h := l.host("example.com")
+
+	// penalty of host without Retry-After doubles up to MaxPenalty
+	for n, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		l.Throttle("example.com", 0)
+		if h.penalty != want {
+			t.Errorf("throttle %d: penalty %s, want %s", n, h.penalty, want)
+		}
+	}
+
+	l.Succeed("example.com")
+	if h.penalty != 0 {
+		t.Errorf("penalty %s after success, want 0", h.penalty)
+	}
+
+	// Retry-After pauses host without changing penalty, shorter pause keeps longer one
+	l.Throttle("example.com", time.Minute)
+	l.Throttle("example.com", time.Second)
+	if wait := h.take(time.Now()); wait < 59*time.Second || h.penalty != 0 {
+		t.Errorf("wait %s and penalty %s after Retry-After 1m", wait, h.penalty)
+	}
+}
+
+func TestAcquireConnections(t *testing.T) {
+	l := NewLimiter(Limits{Connections: 1})
+
+	release, err := l.Acquire(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, "example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v of second connection, want context.DeadlineExceeded", err)
+	}
+	other, err := l.Acquire(context.Background(), "other.com")
+	if err != nil {
+		t.Fatalf("connection of other host: %v", err)
+	}
+	other()
+
+	release()
+	release, err = l.Acquire(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"missing", "", 0, false},
+		{"seconds", "120", 2 * time.Minute, true},
+		{"zero", "0", 0, true},
+		{"date", "Tue, 02 Jan 2024 12:00:30 GMT", 30 * time.Second, true},
+		{"past date", "Tue, 02 Jan 2024 11:00:00 GMT", 0, true},
+		{"negative", "-5", 0, false},
+		{"malformed", "soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+			got, ok := RetryAfter(resp, now)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("RetryAfter(%q) = %s, %v, want %s, %v", tt.header, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       int
+		retryAfter string
+		forbidden  bool
+		paused     bool
+	}{
+		{"ok", http.StatusOK, "", false, false},
+		{"too many requests", http.StatusTooManyRequests, "", false, true},
+		{"forbidden of throttling host", http.StatusForbidden, "", true, true},
+		{"forbidden of other host", http.StatusForbidden, "", false, false},
+		{"unavailable with Retry-After", http.StatusServiceUnavailable, "5", false, true},
+		{"unavailable", http.StatusServiceUnavailable, "", false, false},
+		{"not found", http.StatusNotFound, "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(status(tt.code, tt.retryAfter))
+			defer srv.Close()
+			host := srv.Listener.Addr().String()
+
+			l := NewLimiter(Limits{})
+			if tt.forbidden {
+				l.ForbiddenHosts[host] = true
+			}
+			client := &http.Client{Transport: l.Transport(srv.Client().Transport)}
+
+			resp, err := client.Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			if paused := l.host(host).take(time.Now()) > 0; paused != tt.paused {
+				t.Errorf("paused %v, want %v", paused, tt.paused)
+			}
+		})
+	}
+}
+
+func TestBandwidth(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	// 36 bytes at 24 bytes per second: the burst of 24 bytes is free, the
+	// rest takes half a second
+	l := NewLimiter(Limits{Bandwidth: 24})
+	client := &http.Client{Transport: l.Transport(srv.Client().Transport)}
+
+	start := time.Now()
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(b) != testContent {
+		t.Fatalf("body %q, %v", b, err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("read in %s, want about 500ms", elapsed)
+	}
+}
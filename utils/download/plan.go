@@ -0,0 +1,58 @@
+package download
+
+import (
+	"sort"
+)
+
+// Range bytes From..To (inclusive) of file. To == 0 means up to the end of file
+type Range struct {
+	From uint64
+	To   uint64
+}
+
+// Span ranges merged into one request
+type Span struct {
+	Range
+	// Parts indexes of merged ranges
+	Parts []int
+}
+
+// Plan merge ranges separated by not more than gap bytes into spans ordered
+// by offset. Overlapping and repeated ranges share span
+func Plan(ranges []Range, gap uint64) []Span {
+	order := make([]int, len(ranges))
+	for n := range order {
+		order[n] = n
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return ranges[order[i]].From < ranges[order[j]].From
+	})
+
+	var spans []Span
+	for _, n := range order {
+		r := ranges[n]
+		if k := len(spans) - 1; k >= 0 && spans[k].reaches(r.From, gap) {
+			spans[k].Parts = append(spans[k].Parts, n)
+			if spans[k].To != 0 && (r.To == 0 || r.To > spans[k].To) {
+				spans[k].To = r.To
+			}
+			continue
+		}
+		spans = append(spans, Span{Range: r, Parts: []int{n}})
+	}
+	return spans
+}
+
+// reaches check offset is within gap bytes after the end of span
+func (s Span) reaches(offset, gap uint64) bool {
+	return s.To == 0 || offset <= s.To+1+gap
+}
+
+// Part return offset and length of range r within bytes of span. length is 0
+// when range is up to the end of file
+func (s Span) Part(r Range) (offset, length uint64) {
+	if r.To == 0 {
+		return r.From - s.From, 0
+	}
+	return r.From - s.From, r.To - r.From + 1
+}
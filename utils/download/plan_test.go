@@ -0,0 +1,95 @@
+package download
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []Range
+		gap    uint64
+		want   []Span
+	}{
+		{
+			name: "no ranges",
+			gap:  100,
+		},
+		{
+			name:   "adjacent ranges",
+			ranges: []Range{{0, 99}, {100, 199}},
+			want:   []Span{{Range{0, 199}, []int{0, 1}}},
+		},
+		{
+			name:   "gap within limit",
+			ranges: []Range{{0, 99}, {150, 199}},
+			gap:    50,
+			want:   []Span{{Range{0, 199}, []int{0, 1}}},
+		},
+		{
+			name:   "gap over limit",
+			ranges: []Range{{0, 99}, {151, 199}},
+			gap:    50,
+			want:   []Span{{Range{0, 99}, []int{0}}, {Range{151, 199}, []int{1}}},
+		},
+		{
+			name:   "unordered ranges",
+			ranges: []Range{{500, 599}, {0, 99}, {100, 199}},
+			want:   []Span{{Range{0, 199}, []int{1, 2}}, {Range{500, 599}, []int{0}}},
+		},
+		{
+			name:   "repeated and overlapping ranges",
+			ranges: []Range{{100, 199}, {0, 149}, {100, 199}, {120, 130}},
+			want:   []Span{{Range{0, 199}, []int{1, 0, 2, 3}}},
+		},
+		{
+			name:   "range up to the end of file",
+			ranges: []Range{{300, 0}, {0, 99}, {100, 299}},
+			want:   []Span{{Range{0, 0}, []int{1, 2, 0}}},
+		},
+		{
+			name:   "ranges after span up to the end",
+			ranges: []Range{{0, 0}, {1000, 1999}},
+			want:   []Span{{Range{0, 0}, []int{0, 1}}},
+		},
+		{
+			name:   "range up to the end after gap",
+			ranges: []Range{{0, 99}, {1000, 0}},
+			gap:    10,
+			want:   []Span{{Range{0, 99}, []int{0}}, {Range{1000, 0}, []int{1}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Plan(tt.ranges, tt.gap); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Plan = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpanPart(t *testing.T) {
+	tests := []struct {
+		name           string
+		span           Range
+		r              Range
+		offset, length uint64
+	}{
+		{"first part", Range{100, 399}, Range{100, 199}, 0, 100},
+		{"middle part", Range{100, 399}, Range{250, 299}, 150, 50},
+		{"single part", Range{100, 399}, Range{100, 399}, 0, 300},
+		{"part up to the end", Range{100, 0}, Range{300, 0}, 200, 0},
+		{"bounded part of span up to the end", Range{100, 0}, Range{150, 159}, 50, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, length := Span{Range: tt.span}.Part(tt.r)
+			if offset != tt.offset || length != tt.length {
+				t.Errorf("Part = %d, %d, want %d, %d", offset, length, tt.offset, tt.length)
+			}
+		})
+	}
+}
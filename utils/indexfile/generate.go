@@ -0,0 +1,292 @@
+package indexfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+var (
+	ErrScanGRIB = errors.New("failed to scan GRIB file")
+)
+
+const (
+	// section0Length GRIB2 indicator section length
+	section0Length = 16
+	// section4Number product definition section
+	section4Number = 4
+)
+
+var (
+	gribMagic = []byte("GRIB")
+	endMagic  = []byte("7777")
+)
+
+// Generate scan GRIB2 messages of r section by section and return their
+// inventory as .idx of wgrib2 would list it. Data sections are skipped, not decoded
+func Generate(r io.Reader) (*IndexFile, error) {
+	br := bufio.NewReaderSize(r, 1<<16)
+
+	var (
+		entries []Entry
+		offset  uint64
+		number  int
+	)
+	for {
+		skipped, err := seekMagic(br)
+		offset += skipped
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Join(ErrScanGRIB, err)
+		}
+
+		number++
+		fields, length, err := scanMessage(br)
+		if err != nil {
+			return nil, errors.Join(ErrScanGRIB, fmt.Errorf("message %d at %d: %w", number, offset, err))
+		}
+
+		for n := range fields {
+			fields[n].Line = len(entries) + 1
+			fields[n].Number = number
+			fields[n].From = offset
+			fields[n].To = offset + length - 1
+			if len(fields) > 1 {
+				fields[n].SubNumber = n + 1
+			}
+			entries = append(entries, fields[n])
+		}
+		offset += length
+	}
+
+	return newIndexFile(entries), nil
+}
+
+// Write save entries as .idx lines
+func (f *IndexFile) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range f.entries {
+		if _, err := fmt.Fprintln(bw, e); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// seekMagic skip bytes before "GRIB" and return their count. io.EOF means no
+// more messages
+func seekMagic(br *bufio.Reader) (uint64, error) {
+	var skipped uint64
+	for {
+		head, err := br.Peek(len(gribMagic))
+		if bytes.Equal(head, gribMagic) {
+			return skipped, nil
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return skipped, io.EOF
+			}
+			return skipped, err
+		}
+		if _, err := br.Discard(1); err != nil {
+			return skipped, err
+		}
+		skipped++
+	}
+}
+
+// scanMessage read message starting at "GRIB" and return entries of its fields
+// without numbers and offsets, and message length
+func scanMessage(br *bufio.Reader) ([]Entry, uint64, error) {
+	head := make([]byte, section0Length)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return nil, 0, err
+	}
+	if edition := head[7]; edition != 2 {
+		return nil, 0, fmt.Errorf("GRIB edition %d, only GRIB2 is supported", edition)
+	}
+	discipline := head[6]
+	length := binary.BigEndian.Uint64(head[8:16])
+
+	var (
+		fields      []Entry
+		date        time.Time
+		masterTable uint8
+		read        = uint64(section0Length)
+	)
+	for {
+		if read+uint64(len(endMagic)) > length {
+			return nil, 0, fmt.Errorf("sections exceed message length %d", length)
+		}
+
+		marker, err := br.Peek(len(endMagic))
+		if err != nil {
+			return nil, 0, err
+		}
+		if bytes.Equal(marker, endMagic) {
+			if _, err := br.Discard(len(endMagic)); err != nil {
+				return nil, 0, err
+			}
+			read += uint64(len(endMagic))
+			break
+		}
+
+		sectionHead := make([]byte, 5)
+		if _, err := io.ReadFull(br, sectionHead); err != nil {
+			return nil, 0, err
+		}
+		sectionLength := uint64(binary.BigEndian.Uint32(sectionHead[:4]))
+		if sectionLength < 5 || read+sectionLength > length {
+			return nil, 0, fmt.Errorf("bad length %d of section %d", sectionLength, sectionHead[4])
+		}
+
+		switch sectionHead[4] {
+		case 1, section4Number:
+			section := make([]byte, sectionLength)
+			copy(section, sectionHead)
+			if _, err := io.ReadFull(br, section[5:]); err != nil {
+				return nil, 0, err
+			}
+
+			if sectionHead[4] == 1 {
+				if len(section) < 19 {
+					return nil, 0, errors.New("short section 1")
+				}
+				masterTable = section[9]
+				date = time.Date(int(binary.BigEndian.Uint16(section[12:14])), time.Month(section[14]), int(section[15]),
+					int(section[16]), int(section[17]), int(section[18]), 0, time.UTC)
+			} else {
+				e, err := parseProduct(section, discipline, masterTable)
+				if err != nil {
+					return nil, 0, err
+				}
+				e.Date = date
+				fields = append(fields, e)
+			}
+		default:
+			if _, err := br.Discard(int(sectionLength - 5)); err != nil {
+				return nil, 0, err
+			}
+		}
+		read += sectionLength
+	}
+
+	if read != length {
+		return nil, 0, fmt.Errorf("read %d bytes of message length %d", read, length)
+	}
+	return fields, length, nil
+}
+
+// parseProduct return param, level and forecast of product definition section
+func parseProduct(section []byte, discipline, masterTable uint8) (Entry, error) {
+	// octet k of section is section[k-1]
+	if len(section) < 34 {
+		return Entry{}, errors.New("short section 4")
+	}
+	template := binary.BigEndian.Uint16(section[7:9])
+
+	e := Entry{
+		Param: paramName(discipline, masterTable, section[9], section[10]),
+		Level: levelName(parseSurface(section[22:28]), parseSurface(section[28:34])),
+	}
+
+	unit := section[17]
+	forecast := int(binary.BigEndian.Uint32(section[18:22]))
+
+	// octets of ensemble info and of statistical processing of templates
+	var ens, stat int
+	switch template {
+	case 0:
+	case 1:
+		ens = 35
+	case 8:
+		stat = 47
+	case 11:
+		ens, stat = 35, 50
+	default:
+		e.Forecast = fmt.Sprintf("product template %d", template)
+		return e, nil
+	}
+
+	if ens > 0 && len(section) >= ens+2 {
+		e.Extra = append(e.Extra, ensembleName(section[ens-1], section[ens]))
+	}
+
+	perUnit, ok := timeUnitMinutes[unit]
+	if !ok {
+		e.Forecast = fmt.Sprintf("%d time unit %d fcst", forecast, unit)
+		return e, nil
+	}
+	start := forecast * perUnit
+
+	if stat == 0 {
+		if start == 0 {
+			e.Forecast = "anl"
+		} else {
+			e.Forecast = formatSpan(start) + " fcst"
+		}
+		return e, nil
+	}
+
+	// statistical process, type of time increment, unit and length of time range
+	if len(section) < stat+6 {
+		return Entry{}, fmt.Errorf("short section 4 of template %d", template)
+	}
+	name, ok := statNames[section[stat-1]]
+	if !ok {
+		name = fmt.Sprintf("stat%d", section[stat-1])
+	}
+	rangeUnit, ok := timeUnitMinutes[section[stat+1]]
+	if !ok {
+		e.Forecast = fmt.Sprintf("%s time unit %d fcst", name, section[stat+1])
+		return e, nil
+	}
+	end := start + int(binary.BigEndian.Uint32(section[stat+2:stat+6]))*rangeUnit
+
+	e.Forecast = fmt.Sprintf("%s %s fcst", formatSpan(start, end), name)
+	return e, nil
+}
+
+// parseSurface decode type, scale factor and scaled value of fixed surface
+func parseSurface(b []byte) surface {
+	s := surface{kind: b[0]}
+	if b[1] == 0xff && binary.BigEndian.Uint32(b[2:6]) == 0xffffffff {
+		s.missing = true
+		return s
+	}
+	scale := int(b[1] & 0x7f)
+	if b[1]&0x80 != 0 {
+		scale = -scale
+	}
+	s.value = signMagnitude(binary.BigEndian.Uint32(b[2:6])) / math.Pow10(scale)
+	return s
+}
+
+func signMagnitude(v uint32) float64 {
+	if v&0x80000000 != 0 {
+		return -float64(v &^ 0x80000000)
+	}
+	return float64(v)
+}
+
+// ensembleName return wgrib2 ensemble column of type and perturbation number
+func ensembleName(kind, perturbation uint8) string {
+	switch kind {
+	case 0:
+		return "ENS=hi-res ctl"
+	case 1:
+		return "ENS=low-res ctl"
+	case 2:
+		return fmt.Sprintf("ENS=-%d", perturbation)
+	case 3:
+		return fmt.Sprintf("ENS=+%d", perturbation)
+	}
+	return fmt.Sprintf("ENS=type %d %d", kind, perturbation)
+}
@@ -0,0 +1,217 @@
+package indexfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// product section 4 of template 0, 1, 8 or 11
+type product struct {
+	template         uint16
+	category, number uint8
+	// unit time unit of forecast, hours when 0
+	unit     uint8
+	forecast uint32
+	// first, second fixed surfaces: type, scale factor, scaled value
+	first, second [6]byte
+	// stat statistical process and hours of window of templates 8 and 11
+	stat  uint8
+	hours uint32
+	// ens ensemble type and perturbation of templates 1 and 11
+	ens [2]byte
+}
+
+func level(kind, scale uint8, value uint32) [6]byte {
+	s := [6]byte{kind, scale}
+	binary.BigEndian.PutUint32(s[2:], value)
+	return s
+}
+
+// noLevel missing fixed surface
+var noLevel = [6]byte{255, 255, 255, 255, 255, 255}
+
+func (p product) section() []byte {
+	length := map[uint16]int{0: 34, 1: 37, 8: 58, 11: 61}[p.template]
+	s := make([]byte, length)
+	binary.BigEndian.PutUint32(s, uint32(length))
+	s[4] = 4
+	binary.BigEndian.PutUint16(s[7:], p.template)
+	s[9], s[10] = p.category, p.number
+	s[17] = p.unit
+	if s[17] == 0 {
+		s[17] = 1
+	}
+	binary.BigEndian.PutUint32(s[18:], p.forecast)
+	copy(s[22:], p.first[:])
+	copy(s[28:], p.second[:])
+
+	stat := 0
+	switch p.template {
+	case 1:
+		s[34], s[35] = p.ens[0], p.ens[1]
+	case 8:
+		stat = 47
+	case 11:
+		s[34], s[35] = p.ens[0], p.ens[1]
+		stat = 50
+	}
+	if stat > 0 {
+		s[stat-1] = p.stat
+		s[stat+1] = 1
+		binary.BigEndian.PutUint32(s[stat+2:], p.hours)
+	}
+	return s
+}
+
+// message GRIB2 message of discipline with fields of products. Sections 3, 5,
+// 6 and 7 are filled with junk: Generate skips them
+func message(discipline uint8, products ...product) []byte {
+	section1 := make([]byte, 21)
+	binary.BigEndian.PutUint32(section1, 21)
+	section1[4] = 1
+	section1[9] = 2
+	binary.BigEndian.PutUint16(section1[12:], 2024)
+	section1[14], section1[15], section1[16] = 1, 2, 6
+
+	junk := func(number uint8, size int) []byte {
+		s := bytes.Repeat([]byte{0xaa}, size)
+		binary.BigEndian.PutUint32(s, uint32(size))
+		s[4] = number
+		return s
+	}
+
+	body := append([]byte{}, section1...)
+	body = append(body, junk(3, 72)...)
+	for _, p := range products {
+		body = append(body, p.section()...)
+		body = append(body, junk(5, 21)...)
+		body = append(body, junk(6, 6)...)
+		body = append(body, junk(7, 40)...)
+	}
+	body = append(body, "7777"...)
+
+	msg := []byte{'G', 'R', 'I', 'B', 0, 0, discipline, 2}
+	msg = binary.BigEndian.AppendUint64(msg, uint64(16+len(body)))
+	return append(msg, body...)
+}
+
+func TestGenerate(t *testing.T) {
+	tmp := product{category: 0, number: 0, forecast: 6, first: level(103, 0, 2), second: noLevel}
+	anl := product{category: 3, number: 1, forecast: 0, first: level(101, 0, 0), second: noLevel}
+	apcp := product{template: 8, category: 1, number: 8, forecast: 0, first: level(1, 0, 0), second: noLevel, stat: 1, hours: 6}
+	prate := product{template: 8, category: 1, number: 7, forecast: 3, first: level(1, 0, 0), second: noLevel, stat: 0, hours: 3}
+	ugrd := product{category: 2, number: 2, forecast: 6, first: level(103, 0, 10), second: noLevel}
+	vgrd := product{category: 2, number: 3, forecast: 6, first: level(103, 0, 10), second: noLevel}
+	ens := product{template: 1, category: 0, number: 0, forecast: 90, first: level(100, 0, 50000), second: noLevel, ens: [2]byte{3, 2}}
+	layer := product{category: 1, number: 1, forecast: 6, first: level(100, 0, 100000), second: level(100, 0, 85000)}
+	unknownUnit := product{category: 0, number: 0, unit: 255, forecast: 90, first: level(1, 0, 0), second: noLevel}
+
+	tests := []struct {
+		name string
+		data [][]byte
+		want string
+	}{
+		{
+			name: "instant and statistical fields",
+			data: [][]byte{message(0, tmp), message(0, anl), message(0, apcp), message(0, prate)},
+			want: `1:0:d=2024010206:TMP:2 m above ground:6 hour fcst:
+2:214:d=2024010206:PRMSL:mean sea level:anl:
+3:428:d=2024010206:APCP:surface:0-6 hour acc fcst:
+4:666:d=2024010206:PRATE:surface:3-6 hour ave fcst:
+`,
+		},
+		{
+			name: "multi-field message",
+			data: [][]byte{message(0, ugrd, vgrd), message(2, product{first: level(1, 0, 0), second: noLevel})},
+			want: `1.1:0:d=2024010206:UGRD:10 m above ground:6 hour fcst:
+1.2:0:d=2024010206:VGRD:10 m above ground:6 hour fcst:
+2:315:d=2024010206:LAND:surface:anl:
+`,
+		},
+		{
+			name: "junk between messages",
+			data: [][]byte{[]byte("header"), message(0, tmp), []byte("\x00\x00GRI"), message(0, tmp)},
+			want: `1:6:d=2024010206:TMP:2 m above ground:6 hour fcst:
+2:225:d=2024010206:TMP:2 m above ground:6 hour fcst:
+`,
+		},
+		{
+			name: "ensemble, layer and unknown unit",
+			data: [][]byte{message(0, ens), message(0, layer), message(0, unknownUnit)},
+			want: `1:0:d=2024010206:TMP:500 mb:90 hour fcst:ENS=+2:
+2:217:d=2024010206:RH:1000-850 mb:6 hour fcst:
+3:431:d=2024010206:TMP:surface:90 time unit 255 fcst:
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Join(tt.data, nil)
+			idx, err := Generate(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var b strings.Builder
+			if err := idx.Write(&b); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", b.String(), tt.want)
+			}
+
+			// messages end where the next one starts, the last at the end of data
+			entries := idx.Entries()
+			if last := entries[len(entries)-1]; last.To != uint64(len(data))-1 {
+				t.Errorf("last message ends at %d, want %d", last.To, len(data)-1)
+			}
+
+			// written .idx parses back to the same offsets, parsed messages
+			// also span junk up to the next one
+			parsed, err := Parse(strings.NewReader(b.String()), uint64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for n, e := range parsed.Entries() {
+				if e.From != entries[n].From {
+					t.Errorf("parsed entry %d from %d, want %d", n, e.From, entries[n].From)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	msg := message(0, product{first: level(1, 0, 0), second: noLevel})
+	long := append([]byte{}, msg...)
+	binary.BigEndian.PutUint64(long[8:], uint64(len(msg)+100))
+	bad := append([]byte{}, msg...)
+	binary.BigEndian.PutUint32(bad[16:], 3)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"edition 1", append([]byte("GRIB\x00\x00\x00\x01"), msg[8:]...), "GRIB edition 1"},
+		{"truncated", msg[:len(msg)-30], "message 1 at 0"},
+		{"length beyond data", long, "message 1 at 0"},
+		{"bad section length", bad, "bad length 3 of section 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Generate(bytes.NewReader(tt.data))
+			if !errors.Is(err, ErrScanGRIB) {
+				t.Fatalf("error %v, want ErrScanGRIB", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
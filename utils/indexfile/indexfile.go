@@ -5,39 +5,109 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
-type rangeInfo struct {
-	from uint64
-	to   uint64
+// minColumns number, offset, date, param, level and forecast columns
+const minColumns = 6
+
+// Entry message of .idx line like "12.1:45678:d=2024010100:UGRD:10 m above ground:6 hour fcst:"
+type Entry struct {
+	// Line line number in .idx
+	Line int
+	// Number message number, SubNumber field number of multi-field message (0 when absent)
+	Number    int
+	SubNumber int
+	// From first byte, To last byte of message (inclusive). To is 0 for the
+	// last message of file of unknown length: up to the end of file
+	From uint64
+	To   uint64
+	// Date reference time of "d=YYYYMMDDHH" column
+	Date     time.Time
+	Param    string
+	Level    string
+	Forecast string
+	// Extra columns after forecast, e.g. ensemble info "ENS=low-res ctl"
+	Extra []string
+}
+
+// Key return param:level of entry
+func (e Entry) Key() string {
+	return createKey(e.Param, e.Level)
+}
+
+// Window return forecast window of accumulated and averaged messages
+func (e Entry) Window() (Window, bool) {
+	return parseWindow(e.Forecast)
 }
 
 type IndexFile struct {
-	offsets map[string]rangeInfo
+	// entries every message in file order
+	entries []Entry
+	// messages entries indexes of param:level in file order
+	messages map[string][]int
 }
 
 func createKey(tag, layer string) string {
 	return fmt.Sprintf("%s:%s", tag, layer)
 }
 
+// GetOffset return byte range of the first message of tag and layer
 func (f *IndexFile) GetOffset(tag string, layer string) (uint64, uint64, error) {
-	if r, ok := f.offsets[createKey(tag, layer)]; ok {
-		return r.from, r.to, nil
+	if n, ok := f.messages[createKey(tag, layer)]; ok {
+		return f.entries[n[0]].From, f.entries[n[0]].To, nil
 	} else {
 		return 0, 0, ErrOffsetNotFound
 	}
 }
 
-func newIndexFile(src map[string]*rangeInfo) *IndexFile {
+// Entries return every message in file order
+func (f *IndexFile) Entries() []Entry {
+	return f.entries
+}
+
+// Messages return messages of tag and layer in file order. Keys repeat for
+// messages of different forecast windows or ensemble members
+func (f *IndexFile) Messages(tag, layer string) []Entry {
+	n := f.messages[createKey(tag, layer)]
+	res := make([]Entry, len(n))
+	for i, k := range n {
+		res[i] = f.entries[k]
+	}
+	return res
+}
+
+// Layers return tag and layer of every message ordered by offset
+func (f *IndexFile) Layers() [][2]string {
+	keys := make([]string, 0, len(f.messages))
+	for k := range f.messages {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return f.messages[keys[i]][0] < f.messages[keys[j]][0]
+	})
+
+	res := make([][2]string, len(keys))
+	for i, k := range keys {
+		e := f.entries[f.messages[k][0]]
+		res[i] = [2]string{e.Param, e.Level}
+	}
+	return res
+}
+
+func newIndexFile(entries []Entry) *IndexFile {
 	res := &IndexFile{
-		offsets: make(map[string]rangeInfo, len(src)),
+		entries:  entries,
+		messages: make(map[string][]int, len(entries)),
 	}
 
-	for k, v := range src {
-		res.offsets[k] = *v
+	for n, e := range entries {
+		res.messages[e.Key()] = append(res.messages[e.Key()], n)
 	}
 
 	return res
@@ -50,8 +120,12 @@ var (
 	ErrOffsetNotFound = errors.New("offset not found")
 )
 
-func New(indexFileName string) (res *IndexFile, rErr error) {
+// New parse .idx file of GRIB file of size bytes (0 when unknown), see Parse
+func New(indexFileName string, size uint64) (res *IndexFile, rErr error) {
 	file, err := os.Open(indexFileName)
+	if err != nil {
+		return nil, errors.Join(ErrOpenIndexFile, err)
+	}
 
 	defer func() {
 		err := file.Close()
@@ -60,37 +134,101 @@ func New(indexFileName string) (res *IndexFile, rErr error) {
 		}
 	}()
 
-	if err != nil {
-		return nil, errors.Join(ErrOpenIndexFile, err)
-	}
-
-	scanner := bufio.NewScanner(file)
+	return Parse(file, size)
+}
 
-	offsets := make(map[string]*rangeInfo, 800)
+// Parse read .idx from r, e.g. file or HTTP response body. size is length of
+// GRIB file the index describes, 0 when unknown: To of the last message is 0
+func Parse(r io.Reader, size uint64) (*IndexFile, error) {
+	scanner := bufio.NewScanner(r)
 
-	prevKey := ""
+	entries := make([]Entry, 0, 800)
+	line := 0
 	for scanner.Scan() {
-		cols := strings.Split(scanner.Text(), ":")
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
 
-		col1, err := strconv.Atoi(cols[1])
+		e, err := parseEntry(text)
 		if err != nil {
-			return nil, errors.Join(ErrParseIndexFile, err)
+			return nil, errors.Join(ErrParseIndexFile, fmt.Errorf("line %d: %w", line, err))
+		}
+		e.Line = line
+
+		if n := len(entries); n > 0 && e.From < entries[n-1].From {
+			return nil, errors.Join(ErrParseIndexFile, fmt.Errorf("line %d: offset %d is before offset %d of line %d", line, e.From, entries[n-1].From, entries[n-1].Line))
 		}
-		offset := uint64(col1)
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Join(ErrParseIndexFile, err)
+	}
 
-		key := createKey(cols[3], cols[4])
-		offsets[key] = &rangeInfo{
-			from: offset,
+	// message ends before the next offset; fields of one message share offset
+	var to uint64
+	if size > 0 {
+		to = size - 1
+	}
+	for n := len(entries) - 1; n >= 0; n-- {
+		if n+1 < len(entries) && entries[n+1].From > entries[n].From {
+			to = entries[n+1].From - 1
 		}
+		if size > 0 && entries[n].From >= size {
+			return nil, errors.Join(ErrParseIndexFile, fmt.Errorf("line %d: offset %d is beyond file size %d", entries[n].Line, entries[n].From, size))
+		}
+		entries[n].To = to
+	}
+
+	return newIndexFile(entries), nil
+}
+
+// parseEntry parse columns of .idx line
+func parseEntry(text string) (Entry, error) {
+	cols := strings.Split(text, ":")
+	if len(cols) < minColumns {
+		return Entry{}, fmt.Errorf("%d columns, want at least %d: %q", len(cols), minColumns, text)
+	}
+
+	var (
+		e   Entry
+		err error
+	)
 
-		if prevKey != "" {
-			offsets[prevKey].to = offset - 1
+	number, sub, found := strings.Cut(cols[0], ".")
+	if e.Number, err = strconv.Atoi(number); err != nil {
+		return Entry{}, fmt.Errorf("bad message number %q", cols[0])
+	}
+	if found {
+		if e.SubNumber, err = strconv.Atoi(sub); err != nil {
+			return Entry{}, fmt.Errorf("bad message number %q", cols[0])
 		}
+	}
 
-		prevKey = key
+	if e.From, err = strconv.ParseUint(cols[1], 10, 64); err != nil {
+		return Entry{}, fmt.Errorf("bad offset %q", cols[1])
 	}
 
-	result := newIndexFile(offsets)
-	return result, nil
+	date, ok := strings.CutPrefix(cols[2], "d=")
+	if !ok {
+		return Entry{}, fmt.Errorf("bad reference date %q", cols[2])
+	}
+	if e.Date, err = time.Parse("2006010215", date); err != nil {
+		return Entry{}, fmt.Errorf("bad reference date %q", cols[2])
+	}
+
+	e.Param, e.Level, e.Forecast = cols[3], cols[4], cols[5]
+	if e.Param == "" {
+		return Entry{}, errors.New("empty param")
+	}
+
+	// lines end with ":", keep non-empty extra columns
+	for _, col := range cols[minColumns:] {
+		if col != "" {
+			e.Extra = append(e.Extra, col)
+		}
+	}
 
+	return e, nil
 }
@@ -0,0 +1,134 @@
+package indexfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testIndex .idx with multi-field message 2 and repeated key CRAIN:surface
+const testIndex = `1:0:d=2024010200:PRMSL:mean sea level:6 hour fcst:
+2.1:1000:d=2024010200:UGRD:10 m above ground:6 hour fcst:
+2.2:1000:d=2024010200:VGRD:10 m above ground:6 hour fcst:
+
+3:3000:d=2024010200:CRAIN:surface:6 hour fcst:
+4:4000:d=2024010200:CRAIN:surface:0-6 hour ave fcst:ENS=low-res ctl
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		size uint64
+		// ranges From, To of entries
+		ranges [][2]uint64
+	}{
+		{"known size", 5000, [][2]uint64{{0, 999}, {1000, 2999}, {1000, 2999}, {3000, 3999}, {4000, 4999}}},
+		{"unknown size", 0, [][2]uint64{{0, 999}, {1000, 2999}, {1000, 2999}, {3000, 3999}, {4000, 0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx, err := Parse(strings.NewReader(testIndex), tt.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries := idx.Entries()
+			if len(entries) != len(tt.ranges) {
+				t.Fatalf("%d entries, want %d", len(entries), len(tt.ranges))
+			}
+			for n, e := range entries {
+				if got := [2]uint64{e.From, e.To}; got != tt.ranges[n] {
+					t.Errorf("entry %d range %v, want %v", n, got, tt.ranges[n])
+				}
+			}
+		})
+	}
+}
+
+func TestParseEntries(t *testing.T) {
+	idx, err := Parse(strings.NewReader(testIndex), 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// blank line 4 is counted
+	lines := []int{1, 2, 3, 5, 6}
+	for n, e := range idx.Entries() {
+		if e.Line != lines[n] {
+			t.Errorf("entry %d line %d, want %d", n, e.Line, lines[n])
+		}
+	}
+
+	v := idx.Entries()[2]
+	if v.Number != 2 || v.SubNumber != 2 || v.Param != "VGRD" || v.Level != "10 m above ground" {
+		t.Errorf("entry 2 is %+v", v)
+	}
+	if last := idx.Entries()[4]; len(last.Extra) != 1 || last.Extra[0] != "ENS=low-res ctl" {
+		t.Errorf("extra columns %q", last.Extra)
+	}
+
+	crain := idx.Messages("CRAIN", "surface")
+	if len(crain) != 2 || crain[0].Forecast != "6 hour fcst" || crain[1].Forecast != "0-6 hour ave fcst" {
+		t.Errorf("CRAIN:surface messages %+v", crain)
+	}
+	from, to, err := idx.GetOffset("CRAIN", "surface")
+	if err != nil || from != 3000 || to != 3999 {
+		t.Errorf("GetOffset(CRAIN, surface) = %d, %d, %v, want the first message", from, to, err)
+	}
+	if _, _, err := idx.GetOffset("TMP", "surface"); !errors.Is(err, ErrOffsetNotFound) {
+		t.Errorf("GetOffset of missing key error %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		idx  string
+		size uint64
+		// want text of error
+		want string
+	}{
+		{"few columns", "1:0:d=2024010200:PRMSL:mean sea level:6 hour fcst:\n2:100:d=2024010200:TMP\n", 0, "line 2: 4 columns"},
+		{"bad number", "x:0:d=2024010200:PRMSL:mean sea level:6 hour fcst:\n", 0, "line 1: bad message number"},
+		{"bad sub number", "1.x:0:d=2024010200:PRMSL:mean sea level:6 hour fcst:\n", 0, "line 1: bad message number"},
+		{"bad offset", "\n1:-5:d=2024010200:PRMSL:mean sea level:6 hour fcst:\n", 0, "line 2: bad offset"},
+		{"bad date", "1:0:2024010200:PRMSL:mean sea level:6 hour fcst:\n", 0, "line 1: bad reference date"},
+		{"empty param", "1:0:d=2024010200::mean sea level:6 hour fcst:\n", 0, "line 1: empty param"},
+		{"decreasing offset", "1:0:d=2024010200:PRMSL:mean sea level:6 hour fcst:\n2:500:d=2024010200:TMP:surface:6 hour fcst:\n3:100:d=2024010200:TMP:2 m above ground:6 hour fcst:\n", 0, "line 3: offset 100 is before offset 500 of line 2"},
+		{"offset beyond size", "1:0:d=2024010200:PRMSL:mean sea level:6 hour fcst:\n2:500:d=2024010200:TMP:surface:6 hour fcst:\n", 500, "line 2: offset 500 is beyond file size 500"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.idx), tt.size)
+			if !errors.Is(err, ErrParseIndexFile) {
+				t.Fatalf("error %v, want ErrParseIndexFile", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "gfs.t00z.pgrb2.0p25.f006.idx")
+	if err := os.WriteFile(name, []byte(testIndex), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := New(name, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := idx.Entries(); entries[len(entries)-1].To != 4999 {
+		t.Errorf("last message ends at %d, want 4999", entries[len(entries)-1].To)
+	}
+
+	if _, err := New(name+".missing", 0); !errors.Is(err, ErrOpenIndexFile) {
+		t.Errorf("error %v, want ErrOpenIndexFile", err)
+	}
+}
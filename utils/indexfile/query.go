@@ -0,0 +1,104 @@
+package indexfile
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrBadQuery = errors.New("bad index query")
+)
+
+// Query select messages of index. Empty fields match every message
+type Query struct {
+	// Param parameter abbreviation ("TMP"), case-insensitive
+	Param string
+	// Level level pattern in path.Match syntax ("2 m above ground", "* mb")
+	Level string
+	// Forecast whole forecast column ("anl", "3 hour fcst", "0-6 hour acc fcst"),
+	// case-insensitive
+	Forecast string
+}
+
+// Validate check level pattern, the error wraps path.ErrBadPattern
+func (q Query) Validate() error {
+	if _, err := path.Match(q.Level, ""); err != nil {
+		return errors.Join(ErrBadQuery, fmt.Errorf("level %q: %w", q.Level, err))
+	}
+	return nil
+}
+
+// Match check entry is selected by query. Level pattern must be checked by
+// Validate first, a bad one matches nothing
+func (q Query) Match(e Entry) bool {
+	if q.Param != "" && !strings.EqualFold(q.Param, e.Param) {
+		return false
+	}
+	if q.Level != "" {
+		if ok, _ := path.Match(q.Level, e.Level); !ok {
+			return false
+		}
+	}
+	return q.Forecast == "" || strings.EqualFold(q.Forecast, e.Forecast)
+}
+
+// Find return messages selected by any of queries in file order. No queries
+// select every message
+func (f *IndexFile) Find(queries ...Query) []Entry {
+	if len(queries) == 0 {
+		return f.Entries()
+	}
+
+	var res []Entry
+	for _, e := range f.entries {
+		for _, q := range queries {
+			if q.Match(e) {
+				res = append(res, e)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// GetOffsets return byte ranges of the first messages of tag:layer keys,
+// aligned with keys
+func (f *IndexFile) GetOffsets(keys ...[2]string) ([][2]uint64, error) {
+	res := make([][2]uint64, len(keys))
+	var errs []error
+	for n, k := range keys {
+		from, to, err := f.GetOffset(k[0], k[1])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", createKey(k[0], k[1]), err))
+			continue
+		}
+		res[n] = [2]uint64{from, to}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return res, nil
+}
+
+// String return entry as .idx line, the format of wgrib2 -s
+func (e Entry) String() string {
+	number := strconv.Itoa(e.Number)
+	if e.SubNumber > 0 {
+		number += "." + strconv.Itoa(e.SubNumber)
+	}
+
+	cols := []string{number, strconv.FormatUint(e.From, 10), "d=" + e.Date.Format("2006010215"), e.Param, e.Level, e.Forecast}
+	cols = append(cols, e.Extra...)
+	return strings.Join(cols, ":") + ":"
+}
+
+// Size return message length in bytes, 0 when message spans to the end of file
+func (e Entry) Size() uint64 {
+	if e.To == 0 {
+		return 0
+	}
+	return e.To - e.From + 1
+}
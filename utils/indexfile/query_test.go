@@ -0,0 +1,108 @@
+package indexfile
+
+import (
+	"errors"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// queryIndex .idx with forecast columns sharing suffixes and levels of the same pattern
+const queryIndex = `1:0:d=2024010200:TMP:2 m above ground:3 hour fcst:
+2:1000:d=2024010200:TMP:500 mb:3 hour fcst:
+3:2000:d=2024010200:TMP:850 mb:33 hour fcst:
+4:3000:d=2024010200:RH:850 mb:123 hour fcst:
+5:4000:d=2024010200:APCP:surface:0-3 hour acc fcst:
+6:5000:d=2024010200:PRMSL:mean sea level:anl:
+`
+
+func TestFind(t *testing.T) {
+	idx, err := Parse(strings.NewReader(queryIndex), 6000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		queries []Query
+		// want numbers of found messages
+		want []int
+	}{
+		{"no queries", nil, []int{1, 2, 3, 4, 5, 6}},
+		{"empty query", []Query{{}}, []int{1, 2, 3, 4, 5, 6}},
+		{"param case-folding", []Query{{Param: "tmp"}}, []int{1, 2, 3}},
+		{"level glob", []Query{{Level: "* mb"}}, []int{2, 3, 4}},
+		{"exact level", []Query{{Level: "850 mb"}}, []int{3, 4}},
+		{"exact forecast", []Query{{Forecast: "3 hour fcst"}}, []int{1, 2}},
+		{"forecast case-folding", []Query{{Forecast: "ANL"}}, []int{6}},
+		{"forecast is not substring", []Query{{Forecast: "0-3 hour acc"}}, nil},
+		{"every field", []Query{{Param: "TMP", Level: "* mb", Forecast: "33 hour fcst"}}, []int{3}},
+		{"union in file order", []Query{{Param: "PRMSL"}, {Level: "850 mb"}, {Param: "TMP", Level: "850 mb"}}, []int{3, 4, 6}},
+		{"nothing found", []Query{{Param: "UGRD"}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, e := range idx.Find(tt.queries...) {
+				got = append(got, e.Number)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Find = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       Query
+		wantErr bool
+	}{
+		{"empty", Query{}, false},
+		{"glob", Query{Level: "* mb"}, false},
+		{"class", Query{Level: "[58]00 mb"}, false},
+		{"unclosed class", Query{Level: "[500 mb"}, true},
+		{"trailing escape", Query{Level: "500 mb\\"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.q.Validate()
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrBadQuery) || !errors.Is(err, path.ErrBadPattern) {
+				t.Errorf("error %v, want ErrBadQuery and path.ErrBadPattern", err)
+			}
+		})
+	}
+}
+
+func TestGetOffsets(t *testing.T) {
+	idx, err := Parse(strings.NewReader(queryIndex), 6000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := idx.GetOffsets([2]string{"PRMSL", "mean sea level"}, [2]string{"TMP", "500 mb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][2]uint64{{5000, 5999}, {1000, 1999}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetOffsets = %v, want %v", got, want)
+	}
+
+	_, err = idx.GetOffsets([2]string{"TMP", "500 mb"}, [2]string{"UGRD", "500 mb"})
+	if !errors.Is(err, ErrOffsetNotFound) {
+		t.Fatalf("error %v, want ErrOffsetNotFound", err)
+	}
+	if !strings.Contains(err.Error(), "UGRD") || strings.Contains(err.Error(), "TMP") {
+		t.Errorf("error %q, want only missing key UGRD", err)
+	}
+}
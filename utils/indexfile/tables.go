@@ -0,0 +1,241 @@
+package indexfile
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// paramKey GRIB2 discipline, parameter category and number
+type paramKey struct {
+	discipline, category, number uint8
+}
+
+// paramNames NCEP abbreviations of parameters published in GFS and GFS-Wave files
+var paramNames = map[paramKey]string{
+	// meteorological: temperature
+	{0, 0, 0}:  "TMP",
+	{0, 0, 2}:  "POT",
+	{0, 0, 4}:  "TMAX",
+	{0, 0, 5}:  "TMIN",
+	{0, 0, 6}:  "DPT",
+	{0, 0, 10}: "LHTFL",
+	{0, 0, 11}: "SHTFL",
+	{0, 0, 21}: "APTMP",
+	// moisture
+	{0, 1, 0}:   "SPFH",
+	{0, 1, 1}:   "RH",
+	{0, 1, 3}:   "PWAT",
+	{0, 1, 7}:   "PRATE",
+	{0, 1, 8}:   "APCP",
+	{0, 1, 10}:  "ACPCP",
+	{0, 1, 11}:  "SNOD",
+	{0, 1, 13}:  "WEASD",
+	{0, 1, 22}:  "CLWMR",
+	{0, 1, 39}:  "CPOFP",
+	{0, 1, 192}: "CRAIN",
+	{0, 1, 193}: "CFRZR",
+	{0, 1, 194}: "CICEP",
+	{0, 1, 195}: "CSNOW",
+	{0, 1, 196}: "CPRAT",
+	// momentum
+	{0, 2, 0}:   "WDIR",
+	{0, 2, 1}:   "WIND",
+	{0, 2, 2}:   "UGRD",
+	{0, 2, 3}:   "VGRD",
+	{0, 2, 8}:   "VVEL",
+	{0, 2, 9}:   "DZDT",
+	{0, 2, 10}:  "ABSV",
+	{0, 2, 17}:  "UFLX",
+	{0, 2, 18}:  "VFLX",
+	{0, 2, 22}:  "GUST",
+	{0, 2, 192}: "VWSH",
+	{0, 2, 224}: "VRATE",
+	// mass
+	{0, 3, 0}:   "PRES",
+	{0, 3, 1}:   "PRMSL",
+	{0, 3, 3}:   "ICAHT",
+	{0, 3, 5}:   "HGT",
+	{0, 3, 192}: "MSLET",
+	// radiation
+	{0, 4, 7}:   "DSWRF",
+	{0, 4, 8}:   "USWRF",
+	{0, 4, 192}: "DSWRF",
+	{0, 4, 193}: "USWRF",
+	{0, 5, 3}:   "DLWRF",
+	{0, 5, 4}:   "ULWRF",
+	{0, 5, 192}: "DLWRF",
+	{0, 5, 193}: "ULWRF",
+	// cloud
+	{0, 6, 1}: "TCDC",
+	{0, 6, 3}: "LCDC",
+	{0, 6, 4}: "MCDC",
+	{0, 6, 5}: "HCDC",
+	{0, 6, 6}: "CWAT",
+	// stability
+	{0, 7, 6}:   "CAPE",
+	{0, 7, 7}:   "CIN",
+	{0, 7, 8}:   "HLCY",
+	{0, 7, 192}: "LFTX",
+	{0, 7, 193}: "4LFTX",
+	// ozone, physical atmospheric properties
+	{0, 14, 0}:   "TOZNE",
+	{0, 14, 192}: "O3MR",
+	{0, 19, 0}:   "VIS",
+	{0, 19, 1}:   "ALBDO",
+	{0, 19, 234}: "ICSEV",
+	// land surface
+	{2, 0, 0}:   "LAND",
+	{2, 0, 2}:   "TSOIL",
+	{2, 0, 193}: "GFLUX",
+	{2, 0, 192}: "SOILW",
+	// oceanographic: waves
+	{10, 0, 3}:  "HTSGW",
+	{10, 0, 4}:  "WVDIR",
+	{10, 0, 5}:  "WVHGT",
+	{10, 0, 6}:  "WVPER",
+	{10, 0, 7}:  "SWDIR",
+	{10, 0, 8}:  "SWELL",
+	{10, 0, 9}:  "SWPER",
+	{10, 0, 10}: "DIRPW",
+	{10, 0, 11}: "PERPW",
+	{10, 0, 12}: "DIRSW",
+	{10, 0, 13}: "PERSW",
+	// ice
+	{10, 2, 0}: "ICEC",
+}
+
+// paramName return abbreviation of parameter, wgrib2 description of unknown ones
+func paramName(discipline, masterTable, category, number uint8) string {
+	if name, ok := paramNames[paramKey{discipline, category, number}]; ok {
+		return name
+	}
+	return fmt.Sprintf("var discipline=%d master_table=%d parmcat=%d parm=%d", discipline, masterTable, category, number)
+}
+
+// surface fixed surface of section 4 (code table 4.5)
+type surface struct {
+	kind  uint8
+	value float64
+	// missing value is not set
+	missing bool
+}
+
+// surfaceNames names of surfaces without value
+var surfaceNames = map[uint8]string{
+	1:   "surface",
+	2:   "cloud base",
+	3:   "cloud top",
+	4:   "0C isotherm",
+	6:   "max wind",
+	7:   "tropopause",
+	8:   "top of atmosphere",
+	10:  "entire atmosphere",
+	101: "mean sea level",
+	200: "entire atmosphere (considered as a single layer)",
+	204: "highest tropospheric freezing level",
+	211: "boundary layer cloud layer",
+	212: "low cloud bottom level",
+	213: "low cloud top level",
+	214: "low cloud layer",
+	220: "planetary boundary layer",
+	222: "middle cloud bottom level",
+	223: "middle cloud top level",
+	224: "middle cloud layer",
+	232: "high cloud bottom level",
+	233: "high cloud top level",
+	234: "high cloud layer",
+	242: "convective cloud bottom level",
+	243: "convective cloud top level",
+	244: "convective cloud layer",
+}
+
+// levelName return wgrib2 level description of first and second fixed surfaces
+func levelName(first, second surface) string {
+	layer := second.kind != 255 && second.kind == first.kind && !first.missing && !second.missing
+
+	switch first.kind {
+	case 100:
+		if layer {
+			return fmt.Sprintf("%s-%s mb", formatLevel(first.value/100), formatLevel(second.value/100))
+		}
+		return formatLevel(first.value/100) + " mb"
+	case 102:
+		return formatLevel(first.value) + " m above mean sea level"
+	case 103:
+		if layer {
+			return fmt.Sprintf("%s-%s m above ground", formatLevel(first.value), formatLevel(second.value))
+		}
+		return formatLevel(first.value) + " m above ground"
+	case 104:
+		if layer {
+			return fmt.Sprintf("%s-%s sigma layer", formatLevel(first.value), formatLevel(second.value))
+		}
+		return formatLevel(first.value) + " sigma level"
+	case 106:
+		if layer {
+			return fmt.Sprintf("%s-%s m below ground", formatLevel(first.value), formatLevel(second.value))
+		}
+		return formatLevel(first.value) + " m below ground"
+	case 108:
+		if layer {
+			return fmt.Sprintf("%s-%s mb above ground", formatLevel(first.value/100), formatLevel(second.value/100))
+		}
+		return formatLevel(first.value/100) + " mb above ground"
+	case 109:
+		return fmt.Sprintf("PV=%s (Km^2/kg/s) surface", formatLevel(first.value))
+	case 241:
+		return formatLevel(first.value) + " in sequence"
+	}
+
+	if name, ok := surfaceNames[first.kind]; ok {
+		return name
+	}
+	if first.missing {
+		return fmt.Sprintf("level %d", first.kind)
+	}
+	return fmt.Sprintf("level %d %s", first.kind, formatLevel(first.value))
+}
+
+func formatLevel(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// statNames statistical processes of code table 4.10
+var statNames = map[uint8]string{
+	0: StatAverage,
+	1: StatAccumulation,
+	2: "max",
+	3: "min",
+	4: "last-first",
+	5: "RMS",
+	6: "StdDev",
+}
+
+// timeUnitMinutes minutes of time units of code table 4.4
+var timeUnitMinutes = map[uint8]int{
+	0:  1,
+	1:  60,
+	2:  24 * 60,
+	10: 3 * 60,
+	11: 6 * 60,
+	12: 12 * 60,
+}
+
+// formatSpan return time as wgrib2 forecast text: hours when whole, else minutes
+func formatSpan(minutes ...int) string {
+	unit, div := "hour", 60
+	for _, m := range minutes {
+		if m%60 != 0 {
+			unit, div = "min", 1
+		}
+	}
+
+	res := ""
+	for n, m := range minutes {
+		if n > 0 {
+			res += "-"
+		}
+		res += strconv.Itoa(m / div)
+	}
+	return res + " " + unit
+}
@@ -0,0 +1,83 @@
+package indexfile
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Statistical processing of messages over a forecast time window
+const (
+	// StatAccumulation value accumulated over the window ("0-6 hour acc fcst")
+	StatAccumulation = "acc"
+	// StatAverage value averaged over the window ("0-6 hour ave fcst")
+	StatAverage = "ave"
+)
+
+// Window forecast hours a message is accumulated or averaged over
+type Window struct {
+	Start int
+	End   int
+	// Stat StatAccumulation or StatAverage
+	Stat string
+}
+
+// Hours return window length
+func (w Window) Hours() int {
+	return w.End - w.Start
+}
+
+// parseWindow parse forecast column like "0-6 hour acc fcst". ok is false for
+// instant messages ("anl", "6 hour fcst") and other statistics ("max", "min")
+func parseWindow(forecast string) (w Window, ok bool) {
+	fields := strings.Fields(forecast)
+	if len(fields) < 3 {
+		return Window{}, false
+	}
+
+	start, end, found := strings.Cut(fields[0], "-")
+	if !found {
+		return Window{}, false
+	}
+	var err error
+	if w.Start, err = strconv.Atoi(start); err != nil {
+		return Window{}, false
+	}
+	if w.End, err = strconv.Atoi(end); err != nil {
+		return Window{}, false
+	}
+
+	switch fields[1] {
+	case "hour":
+	case "day":
+		w.Start, w.End = w.Start*24, w.End*24
+	default:
+		return Window{}, false
+	}
+
+	w.Stat = fields[2]
+	if w.Stat != StatAccumulation && w.Stat != StatAverage {
+		return Window{}, false
+	}
+	return w, w.Start < w.End
+}
+
+// Windows return windows of accumulated and averaged messages of tag and layer
+func (f *IndexFile) Windows(tag, layer string) []Window {
+	var res []Window
+	for _, e := range f.Messages(tag, layer) {
+		if w, ok := e.Window(); ok {
+			res = append(res, w)
+		}
+	}
+	return res
+}
+
+// GetWindowOffset return byte range of tag and layer message over window
+func (f *IndexFile) GetWindowOffset(tag, layer string, w Window) (uint64, uint64, error) {
+	for _, e := range f.Messages(tag, layer) {
+		if ew, ok := e.Window(); ok && ew == w {
+			return e.From, e.To, nil
+		}
+	}
+	return 0, 0, ErrOffsetNotFound
+}
@@ -0,0 +1,58 @@
+package noaa
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	cycleInterval = 6 * time.Hour
+
+	// DefaultLookback number of cycles probed when searching the latest run (2 days)
+	DefaultLookback = 8
+)
+
+var (
+	ErrRunNotFound = errors.New("no complete model run found")
+)
+
+// Run model run identified by date and cycle
+type Run struct {
+	Date  time.Time
+	Cycle ModelCycle
+}
+
+// NewRun create run from reference time. Time is truncated to cycle start
+func NewRun(t time.Time) Run {
+	t = t.UTC().Truncate(cycleInterval)
+	return Run{
+		Date:  time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC),
+		Cycle: ModelCycle(fmt.Sprintf("%02d", t.Hour())),
+	}
+}
+
+// Time return run reference time
+func (r Run) Time() time.Time {
+	return r.Date.Add(time.Duration(r.Cycle.Hour()) * time.Hour)
+}
+
+// Prev return previous run
+func (r Run) Prev() Run {
+	return NewRun(r.Time().Add(-cycleInterval))
+}
+
+// Next return next run
+func (r Run) Next() Run {
+	return NewRun(r.Time().Add(cycleInterval))
+}
+
+func (r Run) String() string {
+	return fmt.Sprintf("%sT%sZ", r.Date.Format("20060102"), r.Cycle)
+}
+
+// URL return GRIB file URL of forecast hour
+func (r Run) URL(base string, model Model, forecastTime int, gridSize GridSize) string {
+	year, month, day := r.Date.Date()
+	return URLBuilderFrom(base, model, day, int(month), year, r.Cycle, forecastTime, gridSize)
+}
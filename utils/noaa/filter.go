@@ -0,0 +1,148 @@
+package noaa
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FilterBaseURL NOMADS grib-filter CGI scripts
+	FilterBaseURL = "https://nomads.ncep.noaa.gov/cgi-bin"
+)
+
+// FilterProduct grib-filter dataset (filter_<product>.pl)
+type FilterProduct string
+
+const (
+	FilterGFS0p25 = FilterProduct("gfs_0p25")
+	FilterGFS0p50 = FilterProduct("gfs_0p50")
+	FilterGFS1p00 = FilterProduct("gfs_1p00")
+	FilterFNL     = FilterProduct("fnl")
+)
+
+var (
+	ErrUnknownFilterProduct = errors.New("unknown filter product")
+)
+
+// ParseFilterProduct check s is one of the supported products (gfs_0p25, gfs_0p50, gfs_1p00, fnl)
+func ParseFilterProduct(s string) (FilterProduct, error) {
+	switch p := FilterProduct(s); p {
+	case FilterGFS0p25, FilterGFS0p50, FilterGFS1p00, FilterFNL:
+		return p, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownFilterProduct, s)
+	}
+}
+
+// FilterProductFor return GFS product of grid size
+func FilterProductFor(gridSize GridSize) FilterProduct {
+	switch gridSize {
+	case GridSize0p25:
+		return FilterGFS0p25
+	case GridSize1p00:
+		return FilterGFS1p00
+	default:
+		return FilterGFS0p50
+	}
+}
+
+// GridSize return grid size of product
+func (p FilterProduct) GridSize() GridSize {
+	switch p {
+	case FilterGFS0p25:
+		return GridSize0p25
+	case FilterGFS0p50:
+		return GridSize0p50
+	default:
+		return GridSize1p00
+	}
+}
+
+// Path return directory and file name of product forecast hour, e.g.
+// "/gfs.20240807/00/atmos", "gfs.t00z.pgrb2.0p25.f000"
+func (p FilterProduct) Path(run Run, forecastTime int) (dir, file string) {
+	prefix, kind := "gfs", "pgrb2."
+	switch p {
+	case FilterGFS0p50:
+		// 0.5 degree filter serves the full parameter set
+		kind = "pgrb2full."
+	case FilterFNL:
+		prefix = "gdas"
+	}
+
+	dir = fmt.Sprintf("/%s.%s/%s/%s", prefix, run.Date.Format("20060102"), run.Cycle, ModelAtmo)
+	file = fmt.Sprintf("%s.t%sz.%s%s.f%03d", prefix, run.Cycle, kind, p.GridSize(), forecastTime)
+	return dir, file
+}
+
+// Subregion grib-filter bounding box, degrees
+type Subregion struct {
+	LeftLon   float64
+	RightLon  float64
+	TopLat    float64
+	BottomLat float64
+}
+
+// Filter grib-filter request: product subset by variables, levels and subregion
+type Filter struct {
+	BaseURL string
+	Product FilterProduct
+	// Variables GRIB abbreviations as in .idx files (TMP, UGRD, ...)
+	Variables []string
+	// Levels as in .idx files ("2 m above ground", "surface", ...)
+	Levels []string
+	// Subregion whole globe if nil
+	Subregion *Subregion
+}
+
+// NewFilter create filter against NOMADS
+func NewFilter(product FilterProduct, variables, levels []string) *Filter {
+	return &Filter{
+		BaseURL:   FilterBaseURL,
+		Product:   product,
+		Variables: variables,
+		Levels:    levels,
+	}
+}
+
+// Match check message of variable at level is selected by filter
+func (f *Filter) Match(variable, level string) bool {
+	return slices.Contains(f.Variables, variable) && slices.Contains(f.Levels, level)
+}
+
+// URL return grib-filter URL of forecast hour
+func (f *Filter) URL(run Run, forecastTime int) string {
+	dir, file := f.Product.Path(run, forecastTime)
+
+	q := url.Values{}
+	q.Set("dir", dir)
+	q.Set("file", file)
+	for _, v := range f.Variables {
+		q.Set("var_"+v, "on")
+	}
+	for _, l := range f.Levels {
+		q.Set("lev_"+filterLevel(l), "on")
+	}
+	if r := f.Subregion; r != nil {
+		q.Set("subregion", "")
+		q.Set("leftlon", formatDegrees(r.LeftLon))
+		q.Set("rightlon", formatDegrees(r.RightLon))
+		q.Set("toplat", formatDegrees(r.TopLat))
+		q.Set("bottomlat", formatDegrees(r.BottomLat))
+	}
+
+	return fmt.Sprintf("%s/filter_%s.pl?%s", strings.TrimSuffix(f.BaseURL, "/"), f.Product, q.Encode())
+}
+
+// filterLevel convert .idx level to grib-filter parameter name: "2 m above ground" -> "2_m_above_ground"
+func filterLevel(level string) string {
+	return strings.ReplaceAll(level, " ", "_")
+}
+
+func formatDegrees(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
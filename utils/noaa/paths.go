@@ -1,11 +1,15 @@
 package noaa
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // GFS doc: https://www.emc.ncep.noaa.gov/emc/pages/numerical_forecast_systems/gfs/documentation.php
 
 const (
-	baseURL = "https://nomads.ncep.noaa.gov/pub/data/nccf/com/gfs/prod"
+	BaseURL = "https://nomads.ncep.noaa.gov/pub/data/nccf/com/gfs/prod"
 
 	// filtered url: https://nomads.ncep.noaa.gov/gribfilter.php?ds=fnl
 	// url = "https://nomads.ncep.noaa.gov/cgi-bin/filter_fnl.pl?dir=%2Fgdas.20240807%2F00%2Fatmos&file=gdas.t00z.pgrb2.1p00.f000&var_PRES=on&var_TMP=on&lev_2_m_above_ground=on&lev_80_m_above_ground=on"
@@ -31,9 +35,87 @@ const (
 	GridSize0p25 = GridSize("0p25")
 	GridSize0p50 = GridSize("0p50")
 	GridSize1p00 = GridSize("1p00")
+	// GridSize0p16 GFS-Wave only
+	GridSize0p16 = GridSize("0p16")
+)
+
+var (
+	ErrUnknownModelCycle = errors.New("unknown model cycle")
+	ErrUnknownGridSize   = errors.New("unknown grid size")
 )
 
+var gridSizeDegrees = map[GridSize]float32{
+	GridSize0p25: 0.25,
+	GridSize0p50: 0.5,
+	GridSize1p00: 1.0,
+}
+
+// waveGridSizeDegrees GFS-Wave global grids
+var waveGridSizeDegrees = map[GridSize]float32{
+	GridSize0p16: 1.0 / 6,
+	GridSize0p25: 0.25,
+}
+
+// ParseModelCycle check s is one of the GFS cycles (00, 06, 12, 18)
+func ParseModelCycle(s string) (ModelCycle, error) {
+	switch c := ModelCycle(s); c {
+	case ModelCycle00, ModelCycle06, ModelCycle12, ModelCycle18:
+		return c, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownModelCycle, s)
+	}
+}
+
+// Hour return cycle start hour (UTC)
+func (c ModelCycle) Hour() int {
+	switch c {
+	case ModelCycle06:
+		return 6
+	case ModelCycle12:
+		return 12
+	case ModelCycle18:
+		return 18
+	default:
+		return 0
+	}
+}
+
+// ParseGridSize check s is one of the supported grid sizes (0p25, 0p50, 1p00)
+func ParseGridSize(s string) (GridSize, error) {
+	g := GridSize(s)
+	if _, ok := gridSizeDegrees[g]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownGridSize, s)
+	}
+	return g, nil
+}
+
+// ParseWaveGridSize check s is one of the GFS-Wave global grids (0p16, 0p25)
+func ParseWaveGridSize(s string) (GridSize, error) {
+	g := GridSize(s)
+	if _, ok := waveGridSizeDegrees[g]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownGridSize, s)
+	}
+	return g, nil
+}
+
+// Degrees return grid step in degrees
+func (g GridSize) Degrees() float32 {
+	if d, ok := gridSizeDegrees[g]; ok {
+		return d
+	}
+	return waveGridSizeDegrees[g]
+}
+
 func URLBuilder(model Model, day int, month int, year int, cycle ModelCycle, forecastTime int, gridSize GridSize) string {
+	return URLBuilderFrom(BaseURL, model, day, month, year, cycle, forecastTime, gridSize)
+}
+
+// URLBuilderFrom same as URLBuilder but with custom base URL (mirror or local stand-in)
+func URLBuilderFrom(base string, model Model, day int, month int, year int, cycle ModelCycle, forecastTime int, gridSize GridSize) string {
+	if model == ModelWave {
+		return waveURL(base, day, month, year, cycle, forecastTime, gridSize)
+	}
+
 	return fmt.Sprintf(
 		"%[9]s/gfs.%[1]d%02[2]d%02[3]d/%[4]s/%[7]s/gfs.t%[4]sz.%[8]s.%[6]s.f%03[5]d",
 		year,
@@ -44,6 +126,22 @@ func URLBuilder(model Model, day int, month int, year int, cycle ModelCycle, for
 		gridSize,
 		model,
 		"pgrb2",
-		baseURL,
+		strings.TrimSuffix(base, "/"),
+	)
+}
+
+// waveURL GFS-Wave global grid file:
+// gfs.YYYYMMDD/HH/wave/gridded/gfswave.tHHz.global.0p25.fFFF.grib2
+func waveURL(base string, day int, month int, year int, cycle ModelCycle, forecastTime int, gridSize GridSize) string {
+	return fmt.Sprintf(
+		"%[7]s/gfs.%[1]d%02[2]d%02[3]d/%[4]s/%[8]s/gridded/gfswave.t%[4]sz.global.%[6]s.f%03[5]d.grib2",
+		year,
+		month,
+		day,
+		cycle,
+		forecastTime,
+		gridSize,
+		strings.TrimSuffix(base, "/"),
+		ModelWave,
 	)
-}
\ No newline at end of file
+}